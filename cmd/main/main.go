@@ -2,23 +2,177 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"go.etcd.io/bbolt"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/sync/errgroup"
+	"jwt-auth/internal/adapters/argon2"
 	"jwt-auth/internal/adapters/bcrypt"
+	"jwt-auth/internal/adapters/bolt"
+	"jwt-auth/internal/adapters/composite"
+	"jwt-auth/internal/adapters/hmac"
+	"jwt-auth/internal/adapters/mail"
+	"jwt-auth/internal/adapters/memory"
 	repo "jwt-auth/internal/adapters/mongo"
+	"jwt-auth/internal/adapters/postgres"
+	redisrepo "jwt-auth/internal/adapters/redis"
 	"jwt-auth/internal/app"
 	"jwt-auth/internal/config"
 	"jwt-auth/internal/httpserver"
 	"jwt-auth/internal/logger"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
 
+func rateLimits(cfg config.Config) (httpserver.RateLimits, error) {
+	var limits httpserver.RateLimits
+	var err error
+	if limits.IP, err = httpserver.ParseRule(cfg.RateLimitIP); err != nil {
+		return limits, err
+	}
+	if limits.Client, err = httpserver.ParseRule(cfg.RateLimitClient); err != nil {
+		return limits, err
+	}
+	parseRoutes := func(routes map[string]string) (map[string]httpserver.Rule, error) {
+		rules := make(map[string]httpserver.Rule, len(routes))
+		for route, rule := range routes {
+			r, err := httpserver.ParseRule(rule)
+			if err != nil {
+				return nil, err
+			}
+			rules[route] = r
+		}
+		return rules, nil
+	}
+	if limits.RoutesIP, err = parseRoutes(cfg.RateLimitRoutesIP); err != nil {
+		return limits, err
+	}
+	limits.RoutesClient, err = parseRoutes(cfg.RateLimitRoutesClient)
+	return limits, err
+}
+
+// rsaKey parses a PEM encoded RSA public key or private key. The private key is nil for a public one
+func rsaKey(data []byte) (*rsa.PublicKey, *rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, fmt.Errorf("no PEM block")
+	}
+	if priv, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return &priv.PublicKey, priv, nil
+	}
+	var parsed any
+	var err error
+	if parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &key.PublicKey, key, nil
+	case *rsa.PublicKey:
+		return key, nil, nil
+	}
+	return nil, nil, fmt.Errorf("not an RSA key")
+}
+
+// jweKeys parses JWE_KEYS values, see config.Config. RSA keys must be private if the
+// service reads its tokens back, i.e. refreshes pairs with the access token
+func jweKeys(specs map[string]string, private bool) ([]app.JWEKey, error) {
+	keys := make([]app.JWEKey, 0, len(specs))
+	for aud, spec := range specs {
+		alg, value, _ := strings.Cut(spec, ":")
+		key := app.JWEKey{Audience: aud}
+		switch alg {
+		case "dir":
+			shared, err := base64.StdEncoding.DecodeString(value)
+			if err != nil || len(shared) != 32 {
+				return nil, fmt.Errorf("audience %q: dir key must be 32 bytes in base64", aud)
+			}
+			key.Shared = shared
+		case "rsa":
+			data, err := os.ReadFile(value)
+			if err != nil {
+				return nil, fmt.Errorf("audience %q: %w", aud, err)
+			}
+			if key.Public, key.Private, err = rsaKey(data); err != nil {
+				return nil, fmt.Errorf("audience %q: %w", aud, err)
+			}
+			if private && key.Private == nil {
+				return nil, fmt.Errorf("audience %q: private RSA key is required unless REFRESH_TOKENS=selector", aud)
+			}
+		default:
+			return nil, fmt.Errorf("audience %q: algorithm must be dir or rsa", aud)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func hasher(name string, cfg config.Config) (composite.Scheme, error) {
+	switch name {
+	case config.HasherBCrypt:
+		return bcrypt.New(cfg.BCryptCost), nil
+	case config.HasherArgon2:
+		params := argon2.Params{
+			Memory:      uint32(cfg.Argon2Memory),
+			Time:        uint32(cfg.Argon2Time),
+			Parallelism: uint8(cfg.Argon2Threads),
+		}
+		// negative and too large values do not survive the conversion
+		if int(params.Memory) != cfg.Argon2Memory || int(params.Time) != cfg.Argon2Time ||
+			int(params.Parallelism) != cfg.Argon2Threads {
+			return nil, fmt.Errorf("invalid argon2 parameters")
+		}
+		if err := params.Validate(); err != nil {
+			return nil, err
+		}
+		return argon2.New(params), nil
+	case config.HasherHMAC:
+		return hmac.New([]byte(cfg.HMACPepper))
+	}
+	return nil, fmt.Errorf("unknown hasher %q", name)
+}
+
+// compositeHasher builds a hasher producing hashes of the given scheme and still accepting
+// hashes of the other known schemes, so they are upgraded on use after a switch
+func compositeHasher(name string, cfg config.Config) (app.Hasher, error) {
+	current, err := hasher(name, cfg)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{config.HasherBCrypt, config.HasherArgon2}
+	if cfg.HMACPepper != "" {
+		names = append(names, config.HasherHMAC)
+	}
+	var legacy []composite.Scheme
+	for _, n := range names {
+		if n == name {
+			continue
+		}
+		s, err := hasher(n, cfg)
+		if err != nil {
+			return nil, err
+		}
+		legacy = append(legacy, s)
+	}
+	return composite.New(current, legacy...), nil
+}
+
 func main() {
 	cfg := config.MustLoad()
 
@@ -26,23 +180,340 @@ func main() {
 	log := logger.Create(cfg.Env)
 	log.Info("starting app", slog.String("env", cfg.Env))
 
-	conn, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoConn))
-	if err == nil {
-		err = conn.Ping(ctx, nil)
+	var conn *mongo.Client
+	needMongo := cfg.StorageDriver == config.DriverMongo || cfg.LockoutStore == config.StoreMongo ||
+		cfg.DPoPStore == config.StoreMongo || cfg.RateLimitStore == config.StoreMongo
+	if needMongo {
+		if cfg.MongoConn == "" || cfg.MongoDB == "" {
+			log.Error("MONGO_CONN and MONGO_DB are required")
+			os.Exit(1)
+		}
+		var err error
+		conn, err = mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoConn))
+		if err == nil {
+			err = conn.Ping(ctx, nil)
+		}
+		if err != nil {
+			log.Error("cannot connect to database", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		if err := repo.Migrate(ctx, conn.Database(cfg.MongoDB)); err != nil {
+			log.Error("cannot migrate database", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	var tokens app.Repo
+	var users app.Users
+	var pool *pgxpool.Pool
+	var boltDB *bbolt.DB
+	var redisClient *redis.Client
+	switch cfg.StorageDriver {
+	case config.DriverMongo:
+		tokens, users = repo.New(conn.Database(cfg.MongoDB)), repo.NewUsers(conn.Database(cfg.MongoDB))
+	case config.DriverPostgres:
+		if cfg.PostgresConn == "" {
+			log.Error("POSTGRES_CONN is required")
+			os.Exit(1)
+		}
+		if cfg.PostgresSweep <= 0 {
+			log.Error("POSTGRES_SWEEP_INTERVAL must be positive")
+			os.Exit(1)
+		}
+		var err error
+		pool, err = pgxpool.New(ctx, cfg.PostgresConn)
+		if err == nil {
+			err = pool.Ping(ctx)
+		}
+		if err != nil {
+			log.Error("cannot connect to database", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		if err := postgres.Migrate(ctx, pool); err != nil {
+			log.Error("cannot migrate database", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		eg.Go(func() error {
+			postgres.RunSweeper(ctx, pool, time.Duration(cfg.PostgresSweep)*time.Second, log)
+			return nil
+		})
+		tokens, users = postgres.New(pool), postgres.NewUsers(pool)
+	case config.DriverBolt:
+		if cfg.BoltSweep <= 0 {
+			log.Error("BOLT_SWEEP_INTERVAL must be positive")
+			os.Exit(1)
+		}
+		var err error
+		if boltDB, err = bolt.Open(cfg.BoltPath); err != nil {
+			log.Error("cannot open database", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		eg.Go(func() error {
+			bolt.RunSweeper(ctx, boltDB, time.Duration(cfg.BoltSweep)*time.Second, log)
+			return nil
+		})
+		tokens, users = bolt.New(boltDB), bolt.NewUsers(boltDB)
+	case config.DriverMemory:
+		memRepo := memory.NewRepo()
+		if cfg.MemorySnapshot != "" {
+			if cfg.MemorySnapInt <= 0 {
+				log.Error("MEMORY_SNAPSHOT_INTERVAL must be positive")
+				os.Exit(1)
+			}
+			if err := memRepo.LoadSnapshot(cfg.MemorySnapshot); err != nil {
+				log.Error("cannot load snapshot", slog.String("error", err.Error()))
+				os.Exit(1)
+			}
+			eg.Go(func() error {
+				memRepo.RunSnapshots(ctx, cfg.MemorySnapshot, time.Duration(cfg.MemorySnapInt)*time.Second, log)
+				return nil
+			})
+		}
+		// user accounts are not kept in memory, account routes respond with 501
+		tokens = memRepo
+	case config.DriverRedis:
+		redisClient = redis.NewClient(&redis.Options{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+		})
+		if err := redisClient.Ping(ctx).Err(); err != nil {
+			log.Error("cannot connect to database", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		// user accounts are not kept in Redis, account routes respond with 501
+		tokens = redisrepo.New(redisClient)
+	default:
+		log.Error("unknown storage driver", slog.String("driver", cfg.StorageDriver))
+		os.Exit(1)
+	}
+	var mailer app.Mailer
+	switch {
+	case cfg.SMTPAddr != "":
+		mailer = mail.NewSMTP(cfg.SMTPAddr, cfg.SMTPFrom, cfg.SMTPUser, cfg.SMTPPassword)
+	case cfg.Env == config.EnvDebug:
+		mailer = mail.NewLog()
+	case users != nil:
+		// tokens in the log would let anyone reading it take over accounts
+		log.Error("SMTP_ADDR is required, tokens are written to the log only in debug")
+		os.Exit(1)
+	}
+	opts := []app.Option{
+		app.WithUsers(users, mailer),
+		app.WithOneTimeExpires(
+			time.Duration(cfg.ResetExpires)*time.Second,
+			time.Duration(cfg.VerifyExpires)*time.Second,
+		),
+	}
+
+	if cfg.RefreshGrace > 0 {
+		opts = append(opts, app.WithRefreshGrace(time.Duration(cfg.RefreshGrace)*time.Second))
+	}
+	if len(cfg.OpaqueClients) > 0 {
+		opts = append(opts, app.WithOpaqueAccess(cfg.OpaqueClients...))
+	}
+	if len(cfg.AccessAudiences) > 0 {
+		opts = append(opts, app.WithAudiences(cfg.AccessAudiences...))
+	}
+	if len(cfg.JWEKeys) > 0 {
+		if cfg.AccessFormat != config.AccessJWT {
+			// PASETO tokens would be issued for the audiences unencrypted
+			log.Error("JWE_KEYS require ACCESS_TOKEN_FORMAT=jwt")
+			os.Exit(1)
+		}
+		keys, err := jweKeys(cfg.JWEKeys, cfg.RefreshTokens != config.RefreshSelector)
+		if err != nil {
+			log.Error("invalid JWE keys", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		opts = append(opts, app.WithJWE(keys...))
+	}
+	switch cfg.AccessFormat {
+	case config.AccessJWT:
+	case config.AccessPASETOLocal, config.AccessPASETOPublic:
+		key, err := base64.StdEncoding.DecodeString(cfg.PASETOKey)
+		if err != nil || len(key) != 32 {
+			log.Error("PASETO_KEY must be 32 bytes in base64")
+			os.Exit(1)
+		}
+		if cfg.AccessFormat == config.AccessPASETOLocal {
+			opts = append(opts, app.WithPASETOLocal(key))
+		} else {
+			opts = append(opts, app.WithPASETOPublic(ed25519.NewKeyFromSeed(key)))
+		}
+	default:
+		log.Error("ACCESS_TOKEN_FORMAT must be jwt, v4.local or v4.public")
+		os.Exit(1)
+	}
+	switch cfg.RefreshTokens {
+	case config.RefreshPair:
+	case config.RefreshSelector:
+		opts = append(opts, app.WithSelectorTokens())
+	default:
+		log.Error("REFRESH_TOKENS must be pair or selector")
+		os.Exit(1)
+	}
+
+	lockout := app.LockoutPolicy{
+		FreeAttempts: cfg.LockoutFree,
+		BaseDelay:    time.Duration(cfg.LockoutDelay) * time.Second,
+		MaxDelay:     time.Duration(cfg.LockoutMaxDelay) * time.Second,
+		Threshold:    cfg.LockoutThreshold,
+		LockDuration: time.Duration(cfg.LockoutDuration) * time.Second,
 	}
+	window := time.Duration(cfg.LockoutWindow) * time.Second
+	switch cfg.LockoutStore {
+	case config.StoreMemory:
+		opts = append(opts, app.WithLockout(memory.NewAttempts(window), lockout))
+	case config.StoreMongo:
+		opts = append(opts, app.WithLockout(repo.NewAttempts(conn.Database(cfg.MongoDB), window), lockout))
+	case "":
+	default:
+		log.Error("LOCKOUT_STORE must be memory or mongo")
+		os.Exit(1)
+	}
+
+	switch cfg.DPoPStore {
+	case config.StoreMemory:
+		opts = append(opts, app.WithDPoP(memory.NewReplayCache()))
+	case config.StoreMongo:
+		opts = append(opts, app.WithDPoP(repo.NewReplayCache(conn.Database(cfg.MongoDB))))
+	default:
+		log.Error("DPOP_REPLAY_STORE must be memory or mongo")
+		os.Exit(1)
+	}
+
+	if cfg.Hasher == config.HasherHMAC {
+		log.Error("hmac hasher is only for tokens, set it as TOKEN_HASHER")
+		os.Exit(1)
+	}
+	h, err := compositeHasher(cfg.Hasher, cfg)
 	if err != nil {
-		log.Error("cannot connect to database", slog.String("error", err.Error()))
+		log.Error("invalid hasher", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
+	if cfg.TokenHasher != "" && cfg.TokenHasher != cfg.Hasher {
+		th, err := compositeHasher(cfg.TokenHasher, cfg)
+		if err != nil {
+			log.Error("invalid token hasher", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		opts = append(opts, app.WithTokenHasher(th))
+	}
 	a := app.New(
-		repo.New(conn.Database(cfg.MongoDB)),
-		bcrypt.New(cfg.BCryptCost),
+		tokens,
+		h,
 		cfg.AccessSecret,
 		time.Duration(cfg.AccessExpires)*time.Second,
 		time.Duration(cfg.RefreshExpires)*time.Second,
+		opts...,
 	)
 
-	srv := httpserver.New(log, cfg.HTTPAddr, cfg.Env, a)
+	srvOpts := []httpserver.Option{
+		httpserver.WithAdminToken(cfg.AdminToken),
+		httpserver.WithIntrospection(cfg.IntrospectToken),
+		httpserver.WithTrustedProxies(cfg.TrustedProxies),
+		httpserver.WithPublicURL(cfg.PublicURL),
+	}
+	switch cfg.ErrorResponse {
+	case config.ResponseLegacy:
+	case config.ResponseProblem:
+		srvOpts = append(srvOpts, httpserver.WithProblemDetails())
+	default:
+		log.Error("ERROR_RESPONSE must be legacy or problem")
+		os.Exit(1)
+	}
+	if cfg.V1Deprecated != "" {
+		deprecated, err := time.Parse(time.RFC3339, cfg.V1Deprecated)
+		if err != nil {
+			log.Error("invalid API_V1_DEPRECATED", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		srvOpts = append(srvOpts, httpserver.WithV1Deprecated(deprecated))
+	}
+	if cfg.V1Sunset != "" {
+		sunset, err := time.Parse(time.RFC3339, cfg.V1Sunset)
+		if err != nil {
+			log.Error("invalid API_V1_SUNSET", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		srvOpts = append(srvOpts, httpserver.WithV1Sunset(sunset))
+	}
+	if len(cfg.CORSOrigins) > 0 {
+		srvOpts = append(srvOpts, httpserver.WithCORS(httpserver.CORS{
+			Origins:     cfg.CORSOrigins,
+			Methods:     cfg.CORSMethods,
+			Headers:     cfg.CORSHeaders,
+			Credentials: cfg.CORSCredentials,
+			MaxAge:      time.Duration(cfg.CORSMaxAge) * time.Second,
+		}))
+	}
+	if cfg.RefreshCookie {
+		sameSite := map[string]http.SameSite{
+			"strict": http.SameSiteStrictMode,
+			"lax":    http.SameSiteLaxMode,
+			"none":   http.SameSiteNoneMode,
+		}[cfg.CookieSameSite]
+		if sameSite == 0 {
+			log.Error("REFRESH_COOKIE_SAMESITE must be strict, lax or none")
+			os.Exit(1)
+		}
+		srvOpts = append(srvOpts, httpserver.WithRefreshCookie(httpserver.RefreshCookie{
+			SameSite: sameSite,
+			Domain:   cfg.CookieDomain,
+			Lifetime: time.Duration(cfg.RefreshExpires) * time.Second,
+		}))
+	}
+	mtls := cfg.TLSClientCA != "" || cfg.TLSRequireCert || len(cfg.TLSClients) > 0
+	if mtls && (cfg.TLSCert == "" || cfg.TLSKey == "") {
+		// the plain HTTP server would never see client certificates
+		log.Error("TLS_CERT_FILE and TLS_KEY_FILE are required by mutual TLS")
+		os.Exit(1)
+	}
+	if mtls && cfg.TLSClientCA == "" {
+		log.Error("TLS_CLIENT_CA_FILE is required by TLS_REQUIRE_CLIENT_CERT and TLS_ALLOWED_CLIENTS")
+		os.Exit(1)
+	}
+	if cfg.TLSCert != "" {
+		srvOpts = append(srvOpts, httpserver.WithTLS(cfg.TLSCert, cfg.TLSKey))
+	}
+	if cfg.TLSClientCA != "" {
+		pem, err := os.ReadFile(cfg.TLSClientCA)
+		if err != nil {
+			log.Error("cannot read client CA bundle", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			log.Error("client CA bundle has no certificates", slog.String("file", cfg.TLSClientCA))
+			os.Exit(1)
+		}
+		srvOpts = append(srvOpts, httpserver.WithClientCA(pool, cfg.TLSRequireCert, cfg.TLSClients))
+	}
+	if cfg.RateLimitStore != "" {
+		limits, err := rateLimits(cfg)
+		if err != nil {
+			log.Error("invalid rate limits", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		var limiter httpserver.RateLimiter
+		switch cfg.RateLimitStore {
+		case config.StoreMemory:
+			limiter = memory.NewRateLimiter()
+		case config.StoreMongo:
+			limiter = repo.NewRateLimiter(conn.Database(cfg.MongoDB))
+		default:
+			log.Error("RATE_LIMIT_STORE must be memory or mongo")
+			os.Exit(1)
+		}
+		srvOpts = append(srvOpts, httpserver.WithRateLimit(limiter, limits))
+	}
+
+	srv, err := httpserver.New(log, cfg.HTTPAddr, cfg.Env, a, srvOpts...)
+	if err != nil {
+		log.Error("cannot create http server", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
 	sigQuit := make(chan os.Signal, 1)
 	signal.Ignore(syscall.SIGHUP, syscall.SIGPIPE)
 	signal.Notify(sigQuit, syscall.SIGINT, syscall.SIGTERM)
@@ -62,8 +533,23 @@ func main() {
 	if err := eg.Wait(); err != nil {
 		log.Error("caught error for graceful shutdown", slog.String("error", err.Error()))
 	}
-	if err := conn.Disconnect(context.Background()); err != nil {
-		log.Error("error during disconnecting MongoDB", slog.String("error", err.Error()))
+	if pool != nil {
+		pool.Close()
+	}
+	if redisClient != nil {
+		if err := redisClient.Close(); err != nil {
+			log.Error("error during disconnecting Redis", slog.String("error", err.Error()))
+		}
+	}
+	if boltDB != nil {
+		if err := boltDB.Close(); err != nil {
+			log.Error("error during closing database", slog.String("error", err.Error()))
+		}
+	}
+	if conn != nil {
+		if err := conn.Disconnect(context.Background()); err != nil {
+			log.Error("error during disconnecting MongoDB", slog.String("error", err.Error()))
+		}
 	}
 	log.Info("server has been shutdown successfully")
 }
@@ -0,0 +1,138 @@
+package argon2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"jwt-auth/internal/app"
+	"strings"
+)
+
+const (
+	saltLen = 16
+	keyLen  = 32
+	// limits of parameters, hashes with greater ones are rejected as invalid
+	maxMemory      = 4 * 1024 * 1024
+	maxTime        = 64
+	maxParallelism = 64
+)
+
+var ErrInvalidHash = errors.New("invalid argon2id hash")
+
+// Params are the cost parameters of Argon2id. Memory is in KiB
+type Params struct {
+	Memory      uint32
+	Time        uint32
+	Parallelism uint8
+}
+
+// Validate checks the parameters against the limits of Decode, hashes produced with
+// other parameters could never be compared
+func (p Params) Validate() error {
+	if p.Memory == 0 || p.Memory > maxMemory {
+		return fmt.Errorf("argon2 memory must be from 1 to %d KiB", maxMemory)
+	}
+	if p.Time == 0 || p.Time > maxTime {
+		return fmt.Errorf("argon2 time must be from 1 to %d", maxTime)
+	}
+	if p.Parallelism == 0 || p.Parallelism > maxParallelism {
+		return fmt.Errorf("argon2 parallelism must be from 1 to %d", maxParallelism)
+	}
+	return nil
+}
+
+// DefaultParams follow the second recommended option of RFC 9106
+var DefaultParams = Params{Memory: 64 * 1024, Time: 3, Parallelism: 4}
+
+// Argon2 is an app.Hasher producing hashes in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>. Parameters are read from the stored
+// hash on comparison, so changing them does not break existing hashes
+type Argon2 struct {
+	params Params
+}
+
+func encode(p Params, salt []byte, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+// Decode parses the PHC string of an Argon2id hash
+func Decode(hash string) (Params, []byte, []byte, error) {
+	var p Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return p, nil, nil, ErrInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if p.Validate() != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrInvalidHash
+	}
+	return p, salt, key, nil
+}
+
+func (a Argon2) Generate(ctx context.Context, token string) (string, error) {
+	const fn = "argon2.Generate"
+
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("fn=%s err='%v'", fn, ctx.Err())
+	}
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	key := argon2.IDKey([]byte(token), salt, a.params.Time, a.params.Memory, a.params.Parallelism, keyLen)
+	return encode(a.params, salt, key), nil
+}
+
+func (a Argon2) Compare(ctx context.Context, hash string, token string) error {
+	const fn = "argon2.Compare"
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, ctx.Err())
+	}
+	p, salt, key, err := Decode(hash)
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	got := argon2.IDKey([]byte(token), salt, p.Time, p.Memory, p.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return app.ErrPermissionDenied
+	}
+	return nil
+}
+
+// Owns reports whether the hash is an Argon2id PHC string
+func (a Argon2) Owns(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+// NeedsRehash reports whether the hash has been produced with other parameters
+func (a Argon2) NeedsRehash(hash string) bool {
+	p, salt, key, err := Decode(hash)
+	return err != nil || p != a.params || len(salt) != saltLen || len(key) != keyLen
+}
+
+func New(params Params) Argon2 {
+	return Argon2{params: params}
+}
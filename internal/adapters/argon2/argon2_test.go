@@ -0,0 +1,96 @@
+package argon2
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app"
+	"strings"
+	"testing"
+)
+
+var testParams = Params{Memory: 1024, Time: 1, Parallelism: 1}
+
+func TestArgon2(t *testing.T) {
+	ctx := context.Background()
+	a := New(testParams)
+	// longer than 72 bytes which bcrypt would truncate
+	token := strings.Repeat("a", 80)
+
+	hash, err := a.Generate(ctx, token)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"), hash)
+
+	another, err := a.Generate(ctx, token)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, another, "salt is random")
+
+	assert.NoError(t, a.Compare(ctx, hash, token))
+	assert.ErrorIs(t, a.Compare(ctx, hash, strings.Repeat("a", 79)+"b"), app.ErrPermissionDenied)
+	assert.NoError(t, New(DefaultParams).Compare(ctx, hash, token), "parameters are read from the hash")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = a.Generate(canceled, token)
+	assert.Error(t, err, "canceled context")
+}
+
+func TestParams_Validate(t *testing.T) {
+	assert.NoError(t, DefaultParams.Validate())
+	assert.NoError(t, Params{Memory: 4 * 1024 * 1024, Time: 64, Parallelism: 64}.Validate(), "the limits")
+	assert.Error(t, Params{Memory: 4*1024*1024 + 1, Time: 3, Parallelism: 4}.Validate())
+	assert.Error(t, Params{Memory: 65536, Time: 65, Parallelism: 4}.Validate())
+	assert.Error(t, Params{Memory: 65536, Time: 3, Parallelism: 65}.Validate())
+	assert.Error(t, Params{Memory: 65536, Time: 0, Parallelism: 4}.Validate())
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		hash    string
+		want    Params
+		wantErr bool
+	}{
+		{
+			name: "correct hash",
+			hash: "$argon2id$v=19$m=65536,t=3,p=4$c2FsdHNhbHQ$aGFzaGhhc2g",
+			want: Params{Memory: 65536, Time: 3, Parallelism: 4},
+		},
+		{
+			name:    "bcrypt hash",
+			hash:    "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy",
+			wantErr: true,
+		},
+		{
+			name:    "argon2i",
+			hash:    "$argon2i$v=19$m=65536,t=3,p=4$c2FsdHNhbHQ$aGFzaGhhc2g",
+			wantErr: true,
+		},
+		{
+			name:    "another version",
+			hash:    "$argon2id$v=16$m=65536,t=3,p=4$c2FsdHNhbHQ$aGFzaGhhc2g",
+			wantErr: true,
+		},
+		{
+			name:    "too much memory",
+			hash:    "$argon2id$v=19$m=999999999,t=3,p=4$c2FsdHNhbHQ$aGFzaGhhc2g",
+			wantErr: true,
+		},
+		{
+			name:    "empty hash",
+			hash:    "$argon2id$v=19$m=65536,t=3,p=4$c2FsdHNhbHQ$",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, _, err := Decode(tt.hash)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidHash)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
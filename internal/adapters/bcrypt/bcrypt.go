@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"golang.org/x/crypto/bcrypt"
 	"jwt-auth/internal/app"
+	"strings"
 )
 
 type BCrypt struct {
@@ -40,6 +41,17 @@ func (b BCrypt) Compare(ctx context.Context, hash string, token string) error {
 	return nil
 }
 
+// Owns reports whether the hash has been produced by bcrypt
+func (b BCrypt) Owns(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// NeedsRehash reports whether the hash has another cost
+func (b BCrypt) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != b.cost
+}
+
 func New(cost int) BCrypt {
 	return BCrypt{cost: cost}
 }
@@ -0,0 +1,142 @@
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"log/slog"
+	"time"
+)
+
+var (
+	bucketTokens    = []byte("tokens")
+	bucketSelectors = []byte("token_selectors")
+	bucketUsers     = []byte("users")
+	bucketEmails    = []byte("user_emails")
+	bucketOneTime   = []byte("one_time_tokens")
+)
+
+// Open opens the database file, creating it and the buckets when needed
+func Open(path string) (*bbolt.DB, error) {
+	const fn = "bolt.Open"
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{bucketTokens, bucketSelectors, bucketUsers, bucketEmails, bucketOneTime} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return db, nil
+}
+
+// expiredGrace keeps expired sessions for a while, so clients refreshing with an
+// outdated token get "expired" instead of "not found", as in MongoDB
+const expiredGrace = time.Hour
+
+// expiring is implemented by records removed by the sweeper. The selector of
+// a refresh session is removed from the index together with it
+type expiring struct {
+	Expires  time.Time `json:"expires"`
+	Selector string    `json:"selector,omitempty"`
+}
+
+// Sweep removes refresh tokens expired more than expiredGrace before now and expired
+// one-time tokens, as the TTL indexes do in MongoDB. It returns the number of removed records
+func Sweep(db *bbolt.DB, now time.Time) (int, error) {
+	const fn = "bolt.Sweep"
+	removed := 0
+	err := db.Update(func(tx *bbolt.Tx) error {
+		buckets := []struct {
+			name   []byte
+			before time.Time
+		}{
+			{name: bucketTokens, before: now.Add(-expiredGrace)},
+			{name: bucketOneTime, before: now},
+		}
+		for _, bucket := range buckets {
+			b := tx.Bucket(bucket.name)
+			var expired [][]byte
+			var selectors [][]byte
+			err := b.ForEach(func(k, v []byte) error {
+				var rec expiring
+				if err := json.Unmarshal(v, &rec); err != nil {
+					return err
+				}
+				if rec.Expires.Before(bucket.before) {
+					expired = append(expired, k)
+					if rec.Selector != "" {
+						selectors = append(selectors, []byte(rec.Selector))
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range expired {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			for _, k := range selectors {
+				if err := tx.Bucket(bucketSelectors).Delete(k); err != nil {
+					return err
+				}
+			}
+			removed += len(expired)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return removed, nil
+}
+
+// RunSweeper calls Sweep every interval until the context is done. The interval must
+// be positive
+func RunSweeper(ctx context.Context, db *bbolt.DB, interval time.Duration, log *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			removed, err := Sweep(db, now.UTC())
+			if err != nil {
+				log.Error("cannot sweep expired tokens", slog.String("error", err.Error()))
+				continue
+			}
+			if removed > 0 {
+				log.Debug("expired tokens swept", slog.Int("removed", removed))
+			}
+		}
+	}
+}
+
+func get(tx *bbolt.Tx, bucket []byte, key string, v any) (bool, error) {
+	raw := tx.Bucket(bucket).Get([]byte(key))
+	if raw == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+func put(tx *bbolt.Tx, bucket []byte, key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucket).Put([]byte(key), raw)
+}
@@ -0,0 +1,122 @@
+package bolt
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app"
+	"jwt-auth/internal/entities"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSweep(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	now := time.Now().UTC()
+	repo, users := New(db), NewUsers(db)
+
+	require.NoError(t, repo.CreateOrUpdate(ctx, entities.NewRefresh("expired", "hash", now.Add(-2*time.Hour))))
+	require.NoError(t, repo.CreateOrUpdate(ctx, entities.NewRefresh("grace", "hash", now.Add(-time.Minute))))
+	require.NoError(t, repo.CreateOrUpdate(ctx, entities.NewRefresh("active", "hash", now.Add(time.Minute))))
+	require.NoError(t, users.CreateOneTimeToken(ctx, entities.NewOneTime(
+		"expired", entities.PurposeEmailVerify, "hash", now.Add(-time.Minute),
+	)))
+
+	removed, err := Sweep(db, now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	_, err = repo.GetTokenByID(ctx, "expired")
+	assert.ErrorIs(t, err, app.ErrNotFound, "expired refresh token is removed")
+	_, err = users.GetOneTimeToken(ctx, "expired", entities.PurposeEmailVerify)
+	assert.ErrorIs(t, err, app.ErrNotFound, "expired one-time token is removed")
+	_, err = repo.GetTokenByID(ctx, "grace")
+	assert.NoError(t, err, "recently expired refresh token is kept")
+	tok, err := repo.GetTokenByID(ctx, "active")
+	require.NoError(t, err, "active token is kept")
+	assert.True(t, tok.Expires.Equal(now.Add(time.Minute)))
+}
+
+func TestRepo_Rotate(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	repo := New(db)
+	exp := time.Now().UTC().Add(time.Minute)
+
+	assert.ErrorIs(t, repo.Rotate(ctx, "hash", entities.NewRefresh("user", "next", exp)), app.ErrNotFound)
+	require.NoError(t, repo.CreateOrUpdate(ctx, entities.NewRefresh("user", "hash", exp)))
+	next := entities.NewRefresh("user", "next", exp)
+	next.Rotated = entities.Rotated{Hash: "hash", Pair: []byte("sealed"), Expires: exp}
+	require.NoError(t, repo.Rotate(ctx, "hash", next))
+	assert.ErrorIs(t, repo.Rotate(ctx, "hash", entities.NewRefresh("user", "other", exp)), app.ErrNotFound,
+		"session is rotated once")
+	tok, err := repo.GetTokenByID(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, "next", tok.Hash)
+	assert.Equal(t, next.Rotated, tok.Rotated, "replaced token is kept for the grace period")
+}
+
+func TestRepo_GetTokenBySelector(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	repo := New(db)
+	now := time.Now().UTC()
+
+	token := entities.NewRefresh("user", "hash", now.Add(time.Minute))
+	token.Selector = "selector"
+	require.NoError(t, repo.CreateOrUpdate(ctx, token))
+	got, err := repo.GetTokenBySelector(ctx, "selector")
+	require.NoError(t, err)
+	assert.Equal(t, "user", got.UserID)
+
+	token.Selector = "next-selector"
+	require.NoError(t, repo.CreateOrUpdate(ctx, token))
+	_, err = repo.GetTokenBySelector(ctx, "selector")
+	assert.ErrorIs(t, err, app.ErrNotFound, "replaced selector is removed from the index")
+
+	expired := entities.NewRefresh("expired", "hash", now.Add(-2*time.Hour))
+	expired.Selector = "expired-selector"
+	require.NoError(t, repo.CreateOrUpdate(ctx, expired))
+	_, err = Sweep(db, now)
+	require.NoError(t, err)
+	_, err = repo.GetTokenBySelector(ctx, "expired-selector")
+	assert.ErrorIs(t, err, app.ErrNotFound, "selector of the swept session is removed")
+
+	require.NoError(t, repo.DeleteTokenByID(ctx, "user"))
+	_, err = repo.GetTokenBySelector(ctx, "next-selector")
+	assert.ErrorIs(t, err, app.ErrNotFound)
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	users := NewUsers(db)
+
+	require.NoError(t, users.CreateUser(ctx, entities.NewUser("id", "user@example.com", "hash")))
+	err = users.CreateUser(ctx, entities.NewUser("another-id", "user@example.com", "hash"))
+	assert.ErrorIs(t, err, app.ErrAlreadyExists, "email is unique")
+
+	require.NoError(t, users.SetVerified(ctx, "id"))
+	usr, err := users.GetUserByEmail(ctx, "user@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, entities.User{ID: "id", Email: "user@example.com", PasswordHash: "hash", Verified: true}, usr)
+	assert.ErrorIs(t, users.UpdatePassword(ctx, "unknown", "hash"), app.ErrNotFound)
+
+	tok := entities.NewOneTime("id", entities.PurposePasswordReset, "hash", time.Now().Add(time.Hour))
+	require.NoError(t, users.CreateOneTimeToken(ctx, tok))
+	wrong := tok
+	wrong.Hash = "another-hash"
+	assert.ErrorIs(t, users.DeleteOneTimeToken(ctx, wrong), app.ErrNotFound, "token is deleted only with its hash")
+	require.NoError(t, users.DeleteOneTimeToken(ctx, tok))
+	assert.ErrorIs(t, users.DeleteOneTimeToken(ctx, tok), app.ErrNotFound, "token is deleted once")
+}
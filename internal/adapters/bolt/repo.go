@@ -0,0 +1,156 @@
+package bolt
+
+import (
+	"context"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"jwt-auth/internal/app"
+	"jwt-auth/internal/entities"
+	"time"
+)
+
+type Repo struct {
+	db *bbolt.DB
+}
+
+type token struct {
+	Selector string    `json:"selector,omitempty"`
+	Hash     string    `json:"hash"`
+	Expires  time.Time `json:"expires"`
+	JKT      string    `json:"jkt"`
+	X5TS256  string    `json:"x5t_s256"`
+
+	RotatedHash    string    `json:"rotated_hash,omitempty"`
+	RotatedPair    []byte    `json:"rotated_pair,omitempty"`
+	RotatedExpires time.Time `json:"rotated_expires"`
+
+	AccessHash    string    `json:"access_hash,omitempty"`
+	AccessExpires time.Time `json:"access_expires"`
+}
+
+// putToken stores the session and keeps the selector index in sync with it
+func putToken(tx *bbolt.Tx, refresh entities.RefreshToken) error {
+	if err := deleteSelector(tx, refresh.UserID); err != nil {
+		return err
+	}
+	if refresh.Selector != "" {
+		if err := tx.Bucket(bucketSelectors).Put([]byte(refresh.Selector), []byte(refresh.UserID)); err != nil {
+			return err
+		}
+	}
+	return put(tx, bucketTokens, refresh.UserID, token{
+		Selector: refresh.Selector,
+		Hash:     refresh.Hash,
+		Expires:  refresh.Expires.UTC(),
+		JKT:      refresh.Confirmation.JKT,
+		X5TS256:  refresh.Confirmation.X5TS256,
+
+		RotatedHash:    refresh.Rotated.Hash,
+		RotatedPair:    refresh.Rotated.Pair,
+		RotatedExpires: refresh.Rotated.Expires.UTC(),
+
+		AccessHash:    refresh.Access.Hash,
+		AccessExpires: refresh.Access.Expires.UTC(),
+	})
+}
+
+// deleteSelector removes the selector of the stored session of the user from the index
+func deleteSelector(tx *bbolt.Tx, userID string) error {
+	var tok token
+	found, err := get(tx, bucketTokens, userID, &tok)
+	if err != nil || !found || tok.Selector == "" {
+		return err
+	}
+	return tx.Bucket(bucketSelectors).Delete([]byte(tok.Selector))
+}
+
+func (r Repo) CreateOrUpdate(_ context.Context, refresh entities.RefreshToken) error {
+	const fn = "bolt.CreateOrUpdate"
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		return putToken(tx, refresh)
+	})
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
+
+func (r Repo) Rotate(_ context.Context, prevHash string, refresh entities.RefreshToken) error {
+	const fn = "bolt.Rotate"
+	return wrap(fn, r.db.Update(func(tx *bbolt.Tx) error {
+		var tok token
+		found, err := get(tx, bucketTokens, refresh.UserID, &tok)
+		if err != nil {
+			return err
+		}
+		if !found || tok.Hash != prevHash {
+			return app.ErrNotFound
+		}
+		return putToken(tx, refresh)
+	}))
+}
+
+func getToken(tx *bbolt.Tx, userID string) (entities.RefreshToken, error) {
+	var tok token
+	found, err := get(tx, bucketTokens, userID, &tok)
+	if err != nil {
+		return entities.RefreshToken{}, err
+	}
+	if !found {
+		return entities.RefreshToken{}, app.ErrNotFound
+	}
+	refresh := entities.NewRefresh(userID, tok.Hash, tok.Expires)
+	refresh.Selector = tok.Selector
+	refresh.Confirmation = entities.Confirmation{JKT: tok.JKT, X5TS256: tok.X5TS256}
+	if tok.RotatedHash != "" {
+		refresh.Rotated = entities.Rotated{Hash: tok.RotatedHash, Pair: tok.RotatedPair, Expires: tok.RotatedExpires}
+	}
+	if tok.AccessHash != "" {
+		refresh.Access = entities.OpaqueAccess{Hash: tok.AccessHash, Expires: tok.AccessExpires}
+	}
+	return refresh, nil
+}
+
+func (r Repo) GetTokenByID(_ context.Context, userID string) (entities.RefreshToken, error) {
+	const fn = "bolt.GetTokenByID"
+	var refresh entities.RefreshToken
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		refresh, err = getToken(tx, userID)
+		return err
+	})
+	return refresh, wrap(fn, err)
+}
+
+func (r Repo) GetTokenBySelector(_ context.Context, selector string) (entities.RefreshToken, error) {
+	const fn = "bolt.GetTokenBySelector"
+	var refresh entities.RefreshToken
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		userID := tx.Bucket(bucketSelectors).Get([]byte(selector))
+		if userID == nil {
+			return app.ErrNotFound
+		}
+		var err error
+		refresh, err = getToken(tx, string(userID))
+		return err
+	})
+	return refresh, wrap(fn, err)
+}
+
+func (r Repo) DeleteTokenByID(_ context.Context, userID string) error {
+	const fn = "bolt.DeleteTokenByID"
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		if err := deleteSelector(tx, userID); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketTokens).Delete([]byte(userID))
+	})
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
+
+func New(db *bbolt.DB) Repo {
+	return Repo{db: db}
+}
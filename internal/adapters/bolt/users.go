@@ -0,0 +1,190 @@
+package bolt
+
+import (
+	"context"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"jwt-auth/internal/app"
+	"jwt-auth/internal/entities"
+	"time"
+)
+
+type Users struct {
+	db *bbolt.DB
+}
+
+type user struct {
+	Email        string `json:"email"`
+	PasswordHash string `json:"password_hash"`
+	Verified     bool   `json:"verified"`
+}
+
+type oneTime struct {
+	Hash    string    `json:"hash"`
+	Expires time.Time `json:"expires"`
+}
+
+func oneTimeID(userID string, purpose entities.Purpose) string {
+	return userID + ":" + string(purpose)
+}
+
+// wrap keeps app errors returned from transactions and annotates the rest
+func wrap(fn string, err error) error {
+	switch err {
+	case nil, app.ErrNotFound, app.ErrAlreadyExists:
+		return err
+	}
+	return fmt.Errorf("fn=%s err='%v'", fn, err)
+}
+
+func (u Users) CreateUser(_ context.Context, usr entities.User) error {
+	const fn = "bolt.CreateUser"
+	return wrap(fn, u.db.Update(func(tx *bbolt.Tx) error {
+		emails := tx.Bucket(bucketEmails)
+		if emails.Get([]byte(usr.Email)) != nil || tx.Bucket(bucketUsers).Get([]byte(usr.ID)) != nil {
+			return app.ErrAlreadyExists
+		}
+		if err := emails.Put([]byte(usr.Email), []byte(usr.ID)); err != nil {
+			return err
+		}
+		return put(tx, bucketUsers, usr.ID, user{
+			Email:        usr.Email,
+			PasswordHash: usr.PasswordHash,
+			Verified:     usr.Verified,
+		})
+	}))
+}
+
+func getUser(tx *bbolt.Tx, userID string) (entities.User, error) {
+	var usr user
+	found, err := get(tx, bucketUsers, userID, &usr)
+	if err != nil {
+		return entities.User{}, err
+	}
+	if !found {
+		return entities.User{}, app.ErrNotFound
+	}
+	return entities.User{
+		ID:           userID,
+		Email:        usr.Email,
+		PasswordHash: usr.PasswordHash,
+		Verified:     usr.Verified,
+	}, nil
+}
+
+func (u Users) GetUserByID(_ context.Context, userID string) (entities.User, error) {
+	const fn = "bolt.GetUserByID"
+	var usr entities.User
+	err := u.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		usr, err = getUser(tx, userID)
+		return err
+	})
+	return usr, wrap(fn, err)
+}
+
+func (u Users) GetUserByEmail(_ context.Context, email string) (entities.User, error) {
+	const fn = "bolt.GetUserByEmail"
+	var usr entities.User
+	err := u.db.View(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(bucketEmails).Get([]byte(email))
+		if id == nil {
+			return app.ErrNotFound
+		}
+		var err error
+		usr, err = getUser(tx, string(id))
+		return err
+	})
+	return usr, wrap(fn, err)
+}
+
+func (u Users) updateUser(fn string, userID string, update func(usr *user)) error {
+	return wrap(fn, u.db.Update(func(tx *bbolt.Tx) error {
+		var usr user
+		found, err := get(tx, bucketUsers, userID, &usr)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return app.ErrNotFound
+		}
+		update(&usr)
+		return put(tx, bucketUsers, userID, usr)
+	}))
+}
+
+func (u Users) UpdatePassword(_ context.Context, userID string, hash string) error {
+	return u.updateUser("bolt.UpdatePassword", userID, func(usr *user) {
+		usr.PasswordHash = hash
+	})
+}
+
+func (u Users) RehashPassword(_ context.Context, userID string, prevHash string, hash string) error {
+	const fn = "bolt.RehashPassword"
+	return wrap(fn, u.db.Update(func(tx *bbolt.Tx) error {
+		var usr user
+		found, err := get(tx, bucketUsers, userID, &usr)
+		if err != nil {
+			return err
+		}
+		if !found || usr.PasswordHash != prevHash {
+			return app.ErrNotFound
+		}
+		usr.PasswordHash = hash
+		return put(tx, bucketUsers, userID, usr)
+	}))
+}
+
+func (u Users) SetVerified(_ context.Context, userID string) error {
+	return u.updateUser("bolt.SetVerified", userID, func(usr *user) {
+		usr.Verified = true
+	})
+}
+
+func (u Users) CreateOneTimeToken(_ context.Context, token entities.OneTimeToken) error {
+	const fn = "bolt.CreateOneTimeToken"
+	return wrap(fn, u.db.Update(func(tx *bbolt.Tx) error {
+		return put(tx, bucketOneTime, oneTimeID(token.UserID, token.Purpose), oneTime{
+			Hash:    token.Hash,
+			Expires: token.Expires.UTC(),
+		})
+	}))
+}
+
+func (u Users) GetOneTimeToken(_ context.Context, userID string, purpose entities.Purpose) (entities.OneTimeToken, error) {
+	const fn = "bolt.GetOneTimeToken"
+	var tok oneTime
+	var found bool
+	err := u.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		found, err = get(tx, bucketOneTime, oneTimeID(userID, purpose), &tok)
+		return err
+	})
+	if err != nil {
+		return entities.OneTimeToken{}, wrap(fn, err)
+	}
+	if !found {
+		return entities.OneTimeToken{}, app.ErrNotFound
+	}
+	return entities.NewOneTime(userID, purpose, tok.Hash, tok.Expires), nil
+}
+
+func (u Users) DeleteOneTimeToken(_ context.Context, token entities.OneTimeToken) error {
+	const fn = "bolt.DeleteOneTimeToken"
+	return wrap(fn, u.db.Update(func(tx *bbolt.Tx) error {
+		id := oneTimeID(token.UserID, token.Purpose)
+		var tok oneTime
+		found, err := get(tx, bucketOneTime, id, &tok)
+		if err != nil {
+			return err
+		}
+		if !found || tok.Hash != token.Hash {
+			return app.ErrNotFound
+		}
+		return tx.Bucket(bucketOneTime).Delete([]byte(id))
+	}))
+}
+
+func NewUsers(db *bbolt.DB) Users {
+	return Users{db: db}
+}
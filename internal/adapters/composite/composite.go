@@ -0,0 +1,61 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"jwt-auth/internal/app"
+)
+
+var ErrUnknownHash = errors.New("hash of unknown algorithm")
+
+// Scheme is a hasher which recognizes its own hashes
+type Scheme interface {
+	app.Hasher
+	Owns(hash string) bool
+	NeedsRehash(hash string) bool
+}
+
+// Composite is an app.Hasher producing hashes with the current scheme and comparing
+// hashes of any known scheme. Hashes of legacy schemes, or of the current one with
+// outdated parameters, are reported by NeedsRehash
+type Composite struct {
+	current Scheme
+	legacy  []Scheme
+}
+
+// owner also reports whether the hash belongs to the current scheme. Schemes are not
+// compared directly, as some of them (hmac) are not comparable
+func (c Composite) owner(hash string) (Scheme, bool) {
+	if c.current.Owns(hash) {
+		return c.current, true
+	}
+	for _, s := range c.legacy {
+		if s.Owns(hash) {
+			return s, false
+		}
+	}
+	return nil, false
+}
+
+func (c Composite) Generate(ctx context.Context, token string) (string, error) {
+	return c.current.Generate(ctx, token)
+}
+
+func (c Composite) Compare(ctx context.Context, hash string, token string) error {
+	const fn = "composite.Compare"
+	s, _ := c.owner(hash)
+	if s == nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, ErrUnknownHash)
+	}
+	return s.Compare(ctx, hash, token)
+}
+
+func (c Composite) NeedsRehash(hash string) bool {
+	_, current := c.owner(hash)
+	return !current || c.current.NeedsRehash(hash)
+}
+
+func New(current Scheme, legacy ...Scheme) Composite {
+	return Composite{current: current, legacy: legacy}
+}
@@ -0,0 +1,60 @@
+package composite
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/adapters/argon2"
+	"jwt-auth/internal/adapters/bcrypt"
+	"jwt-auth/internal/adapters/hmac"
+	"jwt-auth/internal/app"
+	"testing"
+)
+
+func TestComposite(t *testing.T) {
+	ctx := context.Background()
+	params := argon2.Params{Memory: 1024, Time: 1, Parallelism: 1}
+	oldBCrypt, err := bcrypt.New(4).Generate(ctx, "password")
+	require.NoError(t, err)
+	oldArgon2, err := argon2.New(argon2.Params{Memory: 512, Time: 1, Parallelism: 1}).Generate(ctx, "password")
+	require.NoError(t, err)
+
+	c := New(argon2.New(params), bcrypt.New(5))
+	current, err := c.Generate(ctx, "password")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		hash        string
+		needsRehash bool
+	}{
+		{name: "current scheme and parameters", hash: current},
+		{name: "current scheme with old parameters", hash: oldArgon2, needsRehash: true},
+		{name: "legacy scheme", hash: oldBCrypt, needsRehash: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, c.Compare(ctx, tt.hash, "password"))
+			assert.ErrorIs(t, c.Compare(ctx, tt.hash, "wrong-password"), app.ErrPermissionDenied)
+			assert.Equal(t, tt.needsRehash, c.NeedsRehash(tt.hash))
+		})
+	}
+
+	assert.ErrorContains(t, c.Compare(ctx, "plain", "plain"), ErrUnknownHash.Error(), "unknown algorithm")
+	assert.True(t, c.NeedsRehash("plain"))
+}
+
+func TestComposite_hmac(t *testing.T) {
+	ctx := context.Background()
+	h, err := hmac.New([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	legacy, err := bcrypt.New(4).Generate(ctx, "token")
+	require.NoError(t, err)
+
+	c := New(h, bcrypt.New(4))
+	current, err := c.Generate(ctx, "token")
+	require.NoError(t, err)
+	assert.NoError(t, c.Compare(ctx, current, "token"))
+	assert.False(t, c.NeedsRehash(current))
+	assert.True(t, c.NeedsRehash(legacy))
+}
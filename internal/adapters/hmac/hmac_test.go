@@ -0,0 +1,61 @@
+package hmac
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/adapters/bcrypt"
+	"jwt-auth/internal/app"
+	"strings"
+	"testing"
+)
+
+var pepper = []byte(strings.Repeat("p", minPepperLen))
+
+func TestHMAC(t *testing.T) {
+	ctx := context.Background()
+	h, err := New(pepper)
+	require.NoError(t, err)
+
+	hash, err := h.Generate(ctx, "token")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, Prefix))
+
+	assert.NoError(t, h.Compare(ctx, hash, "token"))
+	assert.ErrorIs(t, h.Compare(ctx, hash, "another-token"), app.ErrPermissionDenied)
+	assert.ErrorContains(t, h.Compare(ctx, "$2a$10$bcrypt-hash", "token"), ErrInvalidHash.Error(), "another algorithm")
+
+	other, err := New([]byte(strings.Repeat("o", minPepperLen)))
+	require.NoError(t, err)
+	assert.ErrorIs(t, other.Compare(ctx, hash, "token"), app.ErrPermissionDenied, "another pepper")
+
+	_, err = New([]byte("short"))
+	assert.Error(t, err, "short pepper")
+}
+
+func benchmarkCompare(b *testing.B, h app.Hasher) {
+	ctx := context.Background()
+	token := strings.Repeat("t", 72)
+	hash, err := h.Generate(ctx, token)
+	require.NoError(b, err)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := h.Compare(ctx, hash, token); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// go test -bench=Compare ./internal/adapters/hmac
+func BenchmarkCompare(b *testing.B) {
+	h, err := New(pepper)
+	require.NoError(b, err)
+	b.Run("hmac-sha256", func(b *testing.B) {
+		benchmarkCompare(b, h)
+	})
+	b.Run("bcrypt-10", func(b *testing.B) {
+		benchmarkCompare(b, bcrypt.New(10))
+	})
+}
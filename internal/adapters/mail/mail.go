@@ -0,0 +1,73 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"jwt-auth/internal/logger"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+type SMTP struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (s SMTP) send(ctx context.Context, fn string, to string, subject string, body string) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, ctx.Err())
+	}
+	msg := strings.Join([]string{
+		"From: " + s.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
+
+func (s SMTP) SendPasswordReset(ctx context.Context, email string, token string) error {
+	return s.send(ctx, "mail.SendPasswordReset", email, "Password reset",
+		"Use the following token to reset your password:\r\n\r\n"+token)
+}
+
+func (s SMTP) SendVerification(ctx context.Context, email string, token string) error {
+	return s.send(ctx, "mail.SendVerification", email, "Email verification",
+		"Use the following token to verify your email:\r\n\r\n"+token)
+}
+
+// NewSMTP creates a mailer authenticating with PLAIN auth when the user is set
+func NewSMTP(addr string, from string, user string, password string) SMTP {
+	s := SMTP{addr: addr, from: from}
+	if user != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		s.auth = smtp.PlainAuth("", user, password, host)
+	}
+	return s
+}
+
+// Log writes tokens to the request logger instead of sending them. It is used in
+// the debug environment only, since anyone reading the log could use the tokens
+type Log struct{}
+
+func (Log) SendPasswordReset(ctx context.Context, email string, token string) error {
+	logger.Log(ctx).Info("password reset token", slog.String("email", email), slog.String("token", token))
+	return nil
+}
+
+func (Log) SendVerification(ctx context.Context, email string, token string) error {
+	logger.Log(ctx).Info("verification token", slog.String("email", email), slog.String("token", token))
+	return nil
+}
+
+func NewLog() Log {
+	return Log{}
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"jwt-auth/internal/entities"
+	"sync"
+	"time"
+)
+
+// Attempts is an app.AttemptStore for single-replica deployments
+type Attempts struct {
+	mu        sync.Mutex
+	window    time.Duration
+	attempts  map[string]entities.Attempts
+	lastSweep time.Time
+}
+
+func (a *Attempts) stale(at entities.Attempts, now time.Time) bool {
+	return now.Sub(at.Last) > a.window
+}
+
+// sweep removes stale counters not more often than once per window, so the map
+// does not grow with every client IP ever seen
+func (a *Attempts) sweep(now time.Time) {
+	if now.Sub(a.lastSweep) < a.window {
+		return
+	}
+	for key, at := range a.attempts {
+		if a.stale(at, now) {
+			delete(a.attempts, key)
+		}
+	}
+	a.lastSweep = now
+}
+
+func (a *Attempts) GetAttempts(ctx context.Context, key string) (entities.Attempts, error) {
+	const fn = "memory.GetAttempts"
+
+	if ctx.Err() != nil {
+		return entities.Attempts{}, fmt.Errorf("fn=%s err='%v'", fn, ctx.Err())
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	at, ok := a.attempts[key]
+	if !ok || a.stale(at, time.Now().UTC()) {
+		return entities.Attempts{Key: key}, nil
+	}
+	return at, nil
+}
+
+func (a *Attempts) AddFailure(ctx context.Context, key string, now time.Time) (entities.Attempts, error) {
+	const fn = "memory.AddFailure"
+
+	if ctx.Err() != nil {
+		return entities.Attempts{}, fmt.Errorf("fn=%s err='%v'", fn, ctx.Err())
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sweep(now)
+	at, ok := a.attempts[key]
+	if !ok || a.stale(at, now) {
+		at = entities.Attempts{Key: key}
+	}
+	at.Failures++
+	at.Last = now
+	a.attempts[key] = at
+	return at, nil
+}
+
+func (a *Attempts) ResetAttempts(ctx context.Context, key string) error {
+	const fn = "memory.ResetAttempts"
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, ctx.Err())
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.attempts, key)
+	return nil
+}
+
+// NewAttempts creates a store forgetting failures after the window of inactivity
+func NewAttempts(window time.Duration) *Attempts {
+	return &Attempts{
+		window:    window,
+		attempts:  make(map[string]entities.Attempts),
+		lastSweep: time.Now().UTC(),
+	}
+}
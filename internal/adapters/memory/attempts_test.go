@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestAttempts(t *testing.T) {
+	ctx := context.Background()
+	store := NewAttempts(time.Minute)
+	now := time.Now().UTC()
+
+	at, err := store.GetAttempts(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, 0, at.Failures, "no failures")
+
+	_, err = store.AddFailure(ctx, "user", now.Add(-2*time.Minute))
+	require.NoError(t, err)
+	at, err = store.AddFailure(ctx, "user", now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, at.Failures, "stale counter is restarted")
+
+	at, err = store.AddFailure(ctx, "user", now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, at.Failures, "counter is incremented")
+
+	at, err = store.GetAttempts(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, 2, at.Failures)
+	assert.Equal(t, now, at.Last)
+
+	require.NoError(t, store.ResetAttempts(ctx, "user"))
+	at, err = store.GetAttempts(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, 0, at.Failures, "counter is reset")
+
+	_, err = store.AddFailure(ctx, "stale", now)
+	require.NoError(t, err)
+	_, err = store.AddFailure(ctx, "user", now.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.NotContains(t, store.attempts, "stale", "stale counters are swept")
+}
@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is the time when the bucket is refilled and can be forgotten
+	full time.Time
+}
+
+// RateLimiter is a token bucket storage for single-replica deployments
+type RateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]bucket
+	lastSweep time.Time
+}
+
+const sweepInterval = time.Minute
+
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.After(b.full) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (l *RateLimiter) Take(ctx context.Context, key string, burst int, period time.Duration) (bool, time.Duration, error) {
+	const fn = "memory.Take"
+
+	if ctx.Err() != nil {
+		return false, 0, fmt.Errorf("fn=%s err='%v'", fn, ctx.Err())
+	}
+	now := time.Now()
+	rate := float64(burst) / period.Seconds()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = bucket{tokens: float64(burst), updated: now}
+	}
+	b.tokens = min(float64(burst), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(time.Duration((float64(burst) - b.tokens) / rate * float64(time.Second)))
+	l.buckets[key] = b
+	if !allowed {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second)), nil
+	}
+	return true, 0, nil
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		buckets:   make(map[string]bucket),
+		lastSweep: time.Now(),
+	}
+}
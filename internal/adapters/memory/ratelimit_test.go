@@ -0,0 +1,33 @@
+package memory
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Take(t *testing.T) {
+	ctx := context.Background()
+	l := NewRateLimiter()
+
+	for i := 0; i < 3; i++ {
+		ok, _, err := l.Take(ctx, "key", 3, 300*time.Millisecond)
+		require.NoError(t, err)
+		require.True(t, ok, "burst")
+	}
+	ok, retry, err := l.Take(ctx, "key", 3, 300*time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, ok, "empty bucket")
+	assert.InDelta(t, 100*time.Millisecond, retry, float64(10*time.Millisecond), "time until the next token")
+
+	ok, _, err = l.Take(ctx, "other", 3, 300*time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, ok, "buckets are independent")
+
+	time.Sleep(retry)
+	ok, _, err = l.Take(ctx, "key", 3, 300*time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, ok, "refilled token")
+}
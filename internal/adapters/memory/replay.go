@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ReplayCache is an app.ReplayCache for single-replica deployments
+type ReplayCache struct {
+	mu        sync.Mutex
+	ids       map[string]time.Time
+	lastSweep time.Time
+}
+
+func (r *ReplayCache) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < sweepInterval {
+		return
+	}
+	for id, exp := range r.ids {
+		if now.After(exp) {
+			delete(r.ids, id)
+		}
+	}
+	r.lastSweep = now
+}
+
+func (r *ReplayCache) Add(ctx context.Context, id string, expires time.Time) (bool, error) {
+	const fn = "memory.Add"
+
+	if ctx.Err() != nil {
+		return false, fmt.Errorf("fn=%s err='%v'", fn, ctx.Err())
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sweep(now)
+	if exp, ok := r.ids[id]; ok && now.Before(exp) {
+		return false, nil
+	}
+	r.ids[id] = expires
+	return true, nil
+}
+
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{
+		ids:       make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
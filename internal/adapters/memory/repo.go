@@ -0,0 +1,342 @@
+package memory
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"jwt-auth/internal/app"
+	"jwt-auth/internal/entities"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const shardCount = 32
+
+// item is a stored token with its position in the expiry heap
+type item struct {
+	token entities.RefreshToken
+	index int
+}
+
+type expiryHeap []*item
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].token.Expires.Before(h[j].token.Expires) }
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *expiryHeap) Push(x any) {
+	it := x.(*item)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+func (h *expiryHeap) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return it
+}
+
+type shard struct {
+	mu      sync.RWMutex
+	tokens  map[string]*item
+	expires expiryHeap
+	// selectors maps selectors of the tokens in the shard to user IDs
+	selectors map[string]string
+}
+
+// sweep removes tokens expired before now. The caller holds the lock
+func (s *shard) sweep(now time.Time) {
+	for len(s.expires) > 0 && s.expires[0].token.Expires.Before(now) {
+		it := heap.Pop(&s.expires).(*item)
+		delete(s.tokens, it.token.UserID)
+		delete(s.selectors, it.token.Selector)
+	}
+}
+
+func (s *shard) put(token entities.RefreshToken) {
+	if token.Selector != "" {
+		s.selectors[token.Selector] = token.UserID
+	}
+	if it, ok := s.tokens[token.UserID]; ok {
+		if it.token.Selector != token.Selector {
+			delete(s.selectors, it.token.Selector)
+		}
+		it.token = token
+		heap.Fix(&s.expires, it.index)
+		return
+	}
+	it := &item{token: token}
+	heap.Push(&s.expires, it)
+	s.tokens[token.UserID] = it
+}
+
+func (s *shard) delete(userID string) {
+	if it, ok := s.tokens[userID]; ok {
+		heap.Remove(&s.expires, it.index)
+		delete(s.tokens, userID)
+		delete(s.selectors, it.token.Selector)
+	}
+}
+
+// Repo is an app.Repo keeping refresh tokens in memory. Tokens are spread over
+// shards to reduce lock contention and removed once they expire
+type Repo struct {
+	shards [shardCount]*shard
+}
+
+func (r *Repo) shard(userID string) *shard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(userID))
+	return r.shards[h.Sum32()%shardCount]
+}
+
+func (r *Repo) CreateOrUpdate(ctx context.Context, token entities.RefreshToken) error {
+	const fn = "memory.CreateOrUpdate"
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, ctx.Err())
+	}
+	s := r.shard(token.UserID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(time.Now().UTC())
+	s.put(token)
+	return nil
+}
+
+func (r *Repo) Rotate(ctx context.Context, prevHash string, token entities.RefreshToken) error {
+	const fn = "memory.Rotate"
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, ctx.Err())
+	}
+	s := r.shard(token.UserID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if it, ok := s.tokens[token.UserID]; !ok || it.token.Hash != prevHash {
+		return app.ErrNotFound
+	}
+	s.put(token)
+	return nil
+}
+
+func (r *Repo) GetTokenByID(ctx context.Context, userID string) (entities.RefreshToken, error) {
+	const fn = "memory.GetTokenByID"
+
+	if ctx.Err() != nil {
+		return entities.RefreshToken{}, fmt.Errorf("fn=%s err='%v'", fn, ctx.Err())
+	}
+	s := r.shard(userID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	it, ok := s.tokens[userID]
+	if !ok {
+		return entities.RefreshToken{}, app.ErrNotFound
+	}
+	return it.token, nil
+}
+
+// GetTokenBySelector looks the selector up in every shard, as shards are chosen by user ID
+func (r *Repo) GetTokenBySelector(ctx context.Context, selector string) (entities.RefreshToken, error) {
+	const fn = "memory.GetTokenBySelector"
+
+	if ctx.Err() != nil {
+		return entities.RefreshToken{}, fmt.Errorf("fn=%s err='%v'", fn, ctx.Err())
+	}
+	for _, s := range r.shards {
+		s.mu.RLock()
+		userID, ok := s.selectors[selector]
+		var token entities.RefreshToken
+		if ok {
+			token = s.tokens[userID].token
+		}
+		s.mu.RUnlock()
+		if ok {
+			return token, nil
+		}
+	}
+	return entities.RefreshToken{}, app.ErrNotFound
+}
+
+func (r *Repo) DeleteTokenByID(ctx context.Context, userID string) error {
+	const fn = "memory.DeleteTokenByID"
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, ctx.Err())
+	}
+	s := r.shard(userID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delete(userID)
+	return nil
+}
+
+// Sweep removes expired tokens from every shard. Writes sweep their shard anyway,
+// so it is only needed to release memory of idle shards
+func (r *Repo) Sweep(now time.Time) {
+	for _, s := range r.shards {
+		s.mu.Lock()
+		s.sweep(now)
+		s.mu.Unlock()
+	}
+}
+
+type snapshotToken struct {
+	UserID   string    `json:"user_id"`
+	Selector string    `json:"selector,omitempty"`
+	Hash     string    `json:"hash"`
+	Expires  time.Time `json:"expires"`
+	JKT      string    `json:"jkt,omitempty"`
+	X5TS256  string    `json:"x5t_s256,omitempty"`
+
+	RotatedHash    string    `json:"rotated_hash,omitempty"`
+	RotatedPair    []byte    `json:"rotated_pair,omitempty"`
+	RotatedExpires time.Time `json:"rotated_expires"`
+
+	AccessHash    string    `json:"access_hash,omitempty"`
+	AccessExpires time.Time `json:"access_expires"`
+}
+
+// WriteSnapshot writes unexpired tokens as a JSON array. Shards are locked one by one,
+// so the snapshot is consistent per user, not across all users
+func (r *Repo) WriteSnapshot(w io.Writer) error {
+	now := time.Now().UTC()
+	tokens := make([]snapshotToken, 0)
+	for _, s := range r.shards {
+		s.mu.RLock()
+		for _, it := range s.tokens {
+			tok := it.token
+			if tok.Expires.Before(now) {
+				continue
+			}
+			tokens = append(tokens, snapshotToken{
+				UserID:   tok.UserID,
+				Selector: tok.Selector,
+				Hash:     tok.Hash,
+				Expires:  tok.Expires,
+				JKT:      tok.Confirmation.JKT,
+				X5TS256:  tok.Confirmation.X5TS256,
+
+				RotatedHash:    tok.Rotated.Hash,
+				RotatedPair:    tok.Rotated.Pair,
+				RotatedExpires: tok.Rotated.Expires,
+
+				AccessHash:    tok.Access.Hash,
+				AccessExpires: tok.Access.Expires,
+			})
+		}
+		s.mu.RUnlock()
+	}
+	return json.NewEncoder(w).Encode(tokens)
+}
+
+// ReadSnapshot loads tokens written by WriteSnapshot. Expired tokens are skipped
+func (r *Repo) ReadSnapshot(rd io.Reader) error {
+	var tokens []snapshotToken
+	if err := json.NewDecoder(rd).Decode(&tokens); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, tok := range tokens {
+		if tok.Expires.Before(now) {
+			continue
+		}
+		token := entities.NewRefresh(tok.UserID, tok.Hash, tok.Expires)
+		token.Selector = tok.Selector
+		token.Confirmation = entities.Confirmation{JKT: tok.JKT, X5TS256: tok.X5TS256}
+		if tok.RotatedHash != "" {
+			token.Rotated = entities.Rotated{Hash: tok.RotatedHash, Pair: tok.RotatedPair, Expires: tok.RotatedExpires}
+		}
+		if tok.AccessHash != "" {
+			token.Access = entities.OpaqueAccess{Hash: tok.AccessHash, Expires: tok.AccessExpires}
+		}
+		s := r.shard(tok.UserID)
+		s.mu.Lock()
+		s.put(token)
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// SaveSnapshot writes the snapshot to a temporary file and renames it to path,
+// so a crash during saving does not corrupt the previous snapshot
+func (r *Repo) SaveSnapshot(path string) error {
+	const fn = "memory.SaveSnapshot"
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	defer os.Remove(f.Name())
+	if err := r.WriteSnapshot(f); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
+
+// LoadSnapshot restores tokens from path. A missing file is not an error
+func (r *Repo) LoadSnapshot(path string) error {
+	const fn = "memory.LoadSnapshot"
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	defer f.Close()
+	if err := r.ReadSnapshot(f); err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
+
+// RunSnapshots sweeps expired tokens and saves the snapshot every interval until
+// the context is done. The last snapshot is saved on exit. The interval must be positive
+func (r *Repo) RunSnapshots(ctx context.Context, path string, interval time.Duration, log *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	save := func() {
+		if err := r.SaveSnapshot(path); err != nil {
+			log.Error("cannot save snapshot", slog.String("error", err.Error()))
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			save()
+			return
+		case now := <-ticker.C:
+			r.Sweep(now.UTC())
+			save()
+		}
+	}
+}
+
+func NewRepo() *Repo {
+	r := &Repo{}
+	for i := range r.shards {
+		r.shards[i] = &shard{tokens: make(map[string]*item), selectors: make(map[string]string)}
+	}
+	return r
+}
@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app"
+	"jwt-auth/internal/entities"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRepo(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepo()
+	now := time.Now().UTC()
+
+	_, err := repo.GetTokenByID(ctx, "user")
+	assert.ErrorIs(t, err, app.ErrNotFound)
+
+	token := entities.NewRefresh("user", "hash", now.Add(time.Minute))
+	token.Confirmation.JKT = "thumbprint"
+	require.NoError(t, repo.CreateOrUpdate(ctx, token))
+	got, err := repo.GetTokenByID(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, token, got)
+
+	token.Hash = "new-hash"
+	token.Expires = now.Add(-time.Minute)
+	require.NoError(t, repo.CreateOrUpdate(ctx, token))
+	got, err = repo.GetTokenByID(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, "new-hash", got.Hash, "token is replaced")
+
+	repo.Sweep(now)
+	_, err = repo.GetTokenByID(ctx, "user")
+	assert.ErrorIs(t, err, app.ErrNotFound, "expired token is swept")
+	assert.Empty(t, repo.shard("user").expires, "expiry heap is emptied")
+
+	require.NoError(t, repo.CreateOrUpdate(ctx, entities.NewRefresh("user", "hash", now.Add(time.Minute))))
+	require.NoError(t, repo.DeleteTokenByID(ctx, "user"))
+	_, err = repo.GetTokenByID(ctx, "user")
+	assert.ErrorIs(t, err, app.ErrNotFound, "token is deleted")
+	assert.Empty(t, repo.shard("user").expires, "deleted token leaves the heap")
+}
+
+func TestRepo_concurrent(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepo()
+	exp := time.Now().UTC().Add(time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			userID := fmt.Sprintf("user-%d", i%10)
+			assert.NoError(t, repo.CreateOrUpdate(ctx, entities.NewRefresh(userID, "hash", exp)))
+			_, err := repo.GetTokenByID(ctx, userID)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, s := range repo.shards {
+		assert.Equal(t, len(s.tokens), len(s.expires), "every token is in the heap once")
+		total += len(s.tokens)
+	}
+	assert.Equal(t, 10, total)
+}
+
+func TestRepo_GetTokenBySelector(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepo()
+	now := time.Now().UTC()
+
+	token := entities.NewRefresh("user", "hash", now.Add(time.Minute))
+	token.Selector = "selector"
+	require.NoError(t, repo.CreateOrUpdate(ctx, token))
+	got, err := repo.GetTokenBySelector(ctx, "selector")
+	require.NoError(t, err)
+	assert.Equal(t, token, got)
+
+	token.Selector = "next-selector"
+	token.Expires = now.Add(-time.Minute)
+	require.NoError(t, repo.CreateOrUpdate(ctx, token))
+	_, err = repo.GetTokenBySelector(ctx, "selector")
+	assert.ErrorIs(t, err, app.ErrNotFound, "replaced selector is removed")
+
+	repo.Sweep(now)
+	_, err = repo.GetTokenBySelector(ctx, "next-selector")
+	assert.ErrorIs(t, err, app.ErrNotFound, "selector of the swept token is removed")
+	assert.Empty(t, repo.shard("user").selectors)
+}
+
+func TestRepo_Rotate(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepo()
+	exp := time.Now().UTC().Add(time.Minute)
+
+	err := repo.Rotate(ctx, "hash", entities.NewRefresh("user", "next", exp))
+	assert.ErrorIs(t, err, app.ErrNotFound, "missing session")
+
+	require.NoError(t, repo.CreateOrUpdate(ctx, entities.NewRefresh("user", "hash", exp)))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	rotated := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := repo.Rotate(ctx, "hash", entities.NewRefresh("user", fmt.Sprintf("next-%d", i), exp))
+			if err == nil {
+				mu.Lock()
+				rotated++
+				mu.Unlock()
+			} else {
+				assert.ErrorIs(t, err, app.ErrNotFound)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, rotated, "exactly one rotation wins")
+}
+
+func TestRepo_snapshot(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepo()
+	now := time.Now().UTC()
+
+	active := entities.NewRefresh("active", "hash", now.Add(time.Minute))
+	active.Confirmation.X5TS256 = "thumbprint"
+	active.Selector = "selector"
+	active.Access = entities.OpaqueAccess{Hash: "access-hash", Expires: now.Add(time.Second)}
+	require.NoError(t, repo.CreateOrUpdate(ctx, active))
+	require.NoError(t, repo.CreateOrUpdate(ctx, entities.NewRefresh("expired", "hash", now.Add(-time.Minute))))
+
+	var buf bytes.Buffer
+	require.NoError(t, repo.WriteSnapshot(&buf))
+	restored := NewRepo()
+	require.NoError(t, restored.ReadSnapshot(&buf))
+	got, err := restored.GetTokenByID(ctx, "active")
+	require.NoError(t, err)
+	assert.True(t, got.Expires.Equal(active.Expires))
+	assert.Equal(t, active.Confirmation, got.Confirmation)
+	assert.Equal(t, active.Access.Hash, got.Access.Hash)
+	_, err = restored.GetTokenBySelector(ctx, "selector")
+	require.NoError(t, err, "selector index is restored")
+	_, err = restored.GetTokenByID(ctx, "expired")
+	assert.ErrorIs(t, err, app.ErrNotFound, "expired tokens are not restored")
+
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	require.NoError(t, NewRepo().LoadSnapshot(path), "missing snapshot is ignored")
+	require.NoError(t, repo.SaveSnapshot(path))
+	fromFile := NewRepo()
+	require.NoError(t, fromFile.LoadSnapshot(path))
+	_, err = fromFile.GetTokenByID(ctx, "active")
+	require.NoError(t, err)
+}
@@ -0,0 +1,86 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"jwt-auth/internal/entities"
+	"time"
+)
+
+// Attempts is an app.AttemptStore shared between replicas
+type Attempts struct {
+	attempts *mongo.Collection
+	window   time.Duration
+}
+
+type attempts struct {
+	Failures int                `bson:"failures"`
+	Last     primitive.DateTime `bson:"last"`
+}
+
+func (a Attempts) GetAttempts(ctx context.Context, key string) (entities.Attempts, error) {
+	const fn = "mongo.GetAttempts"
+	// the TTL monitor runs once a minute, so stale documents are filtered explicitly
+	since := primitive.NewDateTimeFromTime(time.Now().UTC().Add(-a.window))
+	res := a.attempts.FindOne(ctx, bson.M{"_id": key, "last": bson.M{"$gte": since}})
+	if errors.Is(res.Err(), mongo.ErrNoDocuments) {
+		return entities.Attempts{Key: key}, nil
+	}
+	if err := res.Err(); err != nil {
+		return entities.Attempts{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	at := attempts{}
+	if err := res.Decode(&at); err != nil {
+		return entities.Attempts{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return entities.Attempts{Key: key, Failures: at.Failures, Last: at.Last.Time()}, nil
+}
+
+func (a Attempts) AddFailure(ctx context.Context, key string, now time.Time) (entities.Attempts, error) {
+	const fn = "mongo.AddFailure"
+	since := primitive.NewDateTimeFromTime(now.Add(-a.window))
+	// the pipeline update restarts the counter of a stale document in the same atomic operation
+	update := mongo.Pipeline{
+		bson.D{primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "failures", Value: bson.D{primitive.E{Key: "$cond", Value: bson.A{
+				bson.D{primitive.E{Key: "$lt", Value: bson.A{"$last", since}}},
+				1,
+				bson.D{primitive.E{Key: "$add", Value: bson.A{"$failures", 1}}},
+			}}}},
+			primitive.E{Key: "last", Value: primitive.NewDateTimeFromTime(now)},
+			// removed by the TTL index after the window of inactivity
+			primitive.E{Key: "expires", Value: primitive.NewDateTimeFromTime(now.Add(a.window))},
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	res := a.attempts.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts)
+	if err := res.Err(); err != nil {
+		return entities.Attempts{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	at := attempts{}
+	if err := res.Decode(&at); err != nil {
+		return entities.Attempts{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return entities.Attempts{Key: key, Failures: at.Failures, Last: at.Last.Time()}, nil
+}
+
+func (a Attempts) ResetAttempts(ctx context.Context, key string) error {
+	const fn = "mongo.ResetAttempts"
+	if _, err := a.attempts.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
+
+// NewAttempts creates a store forgetting failures after the window of inactivity
+func NewAttempts(db *mongo.Database, window time.Duration) Attempts {
+	return Attempts{
+		attempts: db.Collection("attempts"),
+		window:   window,
+	}
+}
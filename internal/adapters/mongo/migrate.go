@@ -0,0 +1,187 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// expiredGrace keeps expired sessions for a while, so clients refreshing with an
+// outdated token get "expired" instead of "not found"
+const expiredGrace = time.Hour
+
+const (
+	// namespaceExists is returned when the collection is created concurrently
+	namespaceExists = 48
+	// namespaceNotFound and indexNotFound are returned when the dropped index does not exist
+	namespaceNotFound = 26
+	indexNotFound     = 27
+)
+
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, db *mongo.Database) error
+}
+
+// migrations are applied in order. Every step must be idempotent: replicas starting
+// together may run it concurrently, the first recorded version wins
+var migrations = []migration{
+	{version: 1, name: "tokens schema and TTL index", up: migrateTokens},
+	{version: 2, name: "users schema and indexes", up: migrateUsers},
+	{version: 3, name: "DPoP proofs and rate limits TTL indexes", up: migrateExpiring},
+	{version: 4, name: "refresh token selector index", up: migrateSelector},
+	{version: 5, name: "login attempts TTL index", up: migrateAttempts},
+}
+
+// Version is the schema version after all migrations are applied
+func Version() int {
+	return migrations[len(migrations)-1].version
+}
+
+// Migrate applies migrations which are not recorded in the schema_migrations collection yet
+func Migrate(ctx context.Context, db *mongo.Database) error {
+	const fn = "mongo.Migrate"
+	applied := db.Collection("schema_migrations")
+	for _, m := range migrations {
+		err := applied.FindOne(ctx, bson.M{"_id": m.version}).Err()
+		if err == nil {
+			continue
+		} else if !errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("fn=%s err='%v'", fn, err)
+		}
+		if err := m.up(ctx, db); err != nil {
+			return fmt.Errorf("fn=%s version=%d err='%v'", fn, m.version, err)
+		}
+		_, err = applied.InsertOne(ctx, bson.D{
+			primitive.E{Key: "_id", Value: m.version},
+			primitive.E{Key: "name", Value: m.name},
+			primitive.E{Key: "applied_at", Value: primitive.NewDateTimeFromTime(time.Now())},
+		})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("fn=%s err='%v'", fn, err)
+		}
+	}
+	return nil
+}
+
+// ensureCollection creates the collection and sets its JSON schema validator. Documents
+// stored before the validator was added are not checked until they are updated
+func ensureCollection(ctx context.Context, db *mongo.Database, name string, schema bson.M) error {
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		err := db.CreateCollection(ctx, name)
+		var cmdErr mongo.CommandError
+		if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Code == namespaceExists) {
+			return err
+		}
+	}
+	return db.RunCommand(ctx, bson.D{
+		primitive.E{Key: "collMod", Value: name},
+		primitive.E{Key: "validator", Value: bson.M{"$jsonSchema": schema}},
+		primitive.E{Key: "validationLevel", Value: "moderate"},
+	}).Err()
+}
+
+func ttlIndex(field string, after time.Duration) mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys:    bson.D{primitive.E{Key: field, Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(after.Seconds())),
+	}
+}
+
+func migrateTokens(ctx context.Context, db *mongo.Database) error {
+	err := ensureCollection(ctx, db, "tokens", bson.M{
+		"bsonType": "object",
+		"required": bson.A{"hash", "expires"},
+		"properties": bson.M{
+			"hash":     bson.M{"bsonType": "string"},
+			"expires":  bson.M{"bsonType": "date"},
+			"jkt":      bson.M{"bsonType": "string"},
+			"x5t_s256": bson.M{"bsonType": "string"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("tokens").Indexes().CreateOne(ctx, ttlIndex("expires", expiredGrace))
+	return err
+}
+
+func migrateUsers(ctx context.Context, db *mongo.Database) error {
+	err := ensureCollection(ctx, db, "users", bson.M{
+		"bsonType": "object",
+		"required": bson.A{"email", "password_hash", "verified"},
+		"properties": bson.M{
+			"email":         bson.M{"bsonType": "string"},
+			"password_hash": bson.M{"bsonType": "string"},
+			"verified":      bson.M{"bsonType": "bool"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{primitive.E{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	err = ensureCollection(ctx, db, "one_time_tokens", bson.M{
+		"bsonType": "object",
+		"required": bson.A{"user_id", "purpose", "hash", "expires"},
+		"properties": bson.M{
+			"user_id": bson.M{"bsonType": "string"},
+			"purpose": bson.M{"bsonType": "string"},
+			"hash":    bson.M{"bsonType": "string"},
+			"expires": bson.M{"bsonType": "date"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("one_time_tokens").Indexes().CreateOne(ctx, ttlIndex("expires", 0))
+	return err
+}
+
+func migrateExpiring(ctx context.Context, db *mongo.Database) error {
+	if _, err := db.Collection("dpop_proofs").Indexes().CreateOne(ctx, ttlIndex("expires", 0)); err != nil {
+		return err
+	}
+	_, err := db.Collection("rate_limits").Indexes().CreateOne(ctx, ttlIndex("full", 0))
+	return err
+}
+
+// migrateSelector indexes selectors of selector.verifier refresh tokens. Sessions of
+// the two-token mode have an empty selector and are left out of the index
+func migrateSelector(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("tokens").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{primitive.E{Key: "selector", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"selector": bson.M{"$gt": ""}}),
+	})
+	return err
+}
+
+// migrateAttempts replaces the TTL index on the last failure, which older versions created
+// at startup with the lockout window of that moment, by the index on the expiry of counters
+func migrateAttempts(ctx context.Context, db *mongo.Database) error {
+	indexes := db.Collection("attempts").Indexes()
+	_, err := indexes.DropOne(ctx, "last_1")
+	var cmdErr mongo.CommandError
+	if err != nil && !(errors.As(err, &cmdErr) && (cmdErr.Code == namespaceNotFound || cmdErr.Code == indexNotFound)) {
+		return err
+	}
+	_, err = indexes.CreateOne(ctx, ttlIndex("expires", 0))
+	return err
+}
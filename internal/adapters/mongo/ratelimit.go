@@ -0,0 +1,85 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// RateLimiter is a token bucket storage shared between replicas
+type RateLimiter struct {
+	buckets *mongo.Collection
+}
+
+type bucket struct {
+	Tokens  float64 `bson:"tokens"`
+	Allowed bool    `bson:"allowed"`
+}
+
+func (l RateLimiter) Take(ctx context.Context, key string, burst int, period time.Duration) (bool, time.Duration, error) {
+	const fn = "mongo.Take"
+	now := primitive.NewDateTimeFromTime(time.Now())
+	// tokens per millisecond, as subtraction of dates gives milliseconds
+	rate := float64(burst) / float64(period.Milliseconds())
+
+	// the bucket is refilled, checked and decremented in one atomic pipeline update
+	refilled := bson.D{primitive.E{Key: "$min", Value: bson.A{
+		burst,
+		bson.D{primitive.E{Key: "$add", Value: bson.A{
+			bson.D{primitive.E{Key: "$ifNull", Value: bson.A{"$tokens", burst}}},
+			bson.D{primitive.E{Key: "$multiply", Value: bson.A{
+				bson.D{primitive.E{Key: "$subtract", Value: bson.A{
+					now,
+					bson.D{primitive.E{Key: "$ifNull", Value: bson.A{"$updated", now}}},
+				}}},
+				rate,
+			}}},
+		}}},
+	}}}
+	update := mongo.Pipeline{
+		bson.D{primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "tokens", Value: refilled},
+			primitive.E{Key: "updated", Value: now},
+		}}},
+		bson.D{primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "allowed", Value: bson.D{primitive.E{Key: "$gte", Value: bson.A{"$tokens", 1}}}},
+		}}},
+		bson.D{primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "tokens", Value: bson.D{primitive.E{Key: "$cond", Value: bson.A{
+				"$allowed",
+				bson.D{primitive.E{Key: "$subtract", Value: bson.A{"$tokens", 1}}},
+				"$tokens",
+			}}}},
+		}}},
+		bson.D{primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "full", Value: bson.D{primitive.E{Key: "$add", Value: bson.A{
+				now,
+				bson.D{primitive.E{Key: "$divide", Value: bson.A{
+					bson.D{primitive.E{Key: "$subtract", Value: bson.A{burst, "$tokens"}}},
+					rate,
+				}}},
+			}}}},
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	res := l.buckets.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts)
+	if err := res.Err(); err != nil {
+		return false, 0, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	b := bucket{}
+	if err := res.Decode(&b); err != nil {
+		return false, 0, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	if !b.Allowed {
+		return false, time.Duration((1-b.Tokens)/rate) * time.Millisecond, nil
+	}
+	return true, 0, nil
+}
+
+func NewRateLimiter(db *mongo.Database) RateLimiter {
+	return RateLimiter{buckets: db.Collection("rate_limits")}
+}
@@ -0,0 +1,33 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// ReplayCache is an app.ReplayCache shared between replicas
+type ReplayCache struct {
+	ids *mongo.Collection
+}
+
+func (r ReplayCache) Add(ctx context.Context, id string, expires time.Time) (bool, error) {
+	const fn = "mongo.Add"
+	_, err := r.ids.InsertOne(ctx, bson.D{
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "expires", Value: primitive.NewDateTimeFromTime(expires)},
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return true, nil
+}
+
+func NewReplayCache(db *mongo.Database) ReplayCache {
+	return ReplayCache{ids: db.Collection("dpop_proofs")}
+}
@@ -16,33 +16,76 @@ type Repo struct {
 	tokens *mongo.Collection
 }
 
-func (r Repo) CreateOrUpdate(ctx context.Context, token entities.RefreshToken) error {
-	const fn = "mongo.CreateOrUpdate"
-	update := bson.D{
+func setToken(token entities.RefreshToken) bson.D {
+	return bson.D{
 		primitive.E{
 			Key: "$set",
 			Value: bson.D{
+				primitive.E{Key: "selector", Value: token.Selector},
 				primitive.E{Key: "hash", Value: token.Hash},
 				primitive.E{Key: "expires", Value: primitive.NewDateTimeFromTime(token.Expires)},
+				primitive.E{Key: "jkt", Value: token.Confirmation.JKT},
+				primitive.E{Key: "x5t_s256", Value: token.Confirmation.X5TS256},
+				primitive.E{Key: "rotated_hash", Value: token.Rotated.Hash},
+				primitive.E{Key: "rotated_pair", Value: token.Rotated.Pair},
+				primitive.E{Key: "rotated_expires", Value: primitive.NewDateTimeFromTime(token.Rotated.Expires)},
+				primitive.E{Key: "access_hash", Value: token.Access.Hash},
+				primitive.E{Key: "access_expires", Value: primitive.NewDateTimeFromTime(token.Access.Expires)},
 			},
 		},
 	}
+}
+
+func (r Repo) CreateOrUpdate(ctx context.Context, token entities.RefreshToken) error {
+	const fn = "mongo.CreateOrUpdate"
 	opts := options.Update().SetUpsert(true)
-	_, err := r.tokens.UpdateByID(ctx, token.UserID, update, opts)
+	_, err := r.tokens.UpdateByID(ctx, token.UserID, setToken(token), opts)
 	if err != nil {
 		return fmt.Errorf("fn=%s err='%v'", fn, err)
 	}
 	return nil
 }
 
+func (r Repo) Rotate(ctx context.Context, prevHash string, token entities.RefreshToken) error {
+	const fn = "mongo.Rotate"
+	res, err := r.tokens.UpdateOne(ctx, bson.M{"_id": token.UserID, "hash": prevHash}, setToken(token))
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	if res.MatchedCount == 0 {
+		return app.ErrNotFound
+	}
+	return nil
+}
+
 type token struct {
-	Hash    string             `json:"hash" bson:"hash"`
-	Expires primitive.DateTime `json:"expires" bson:"expires"`
+	UserID   string             `json:"user_id" bson:"_id"`
+	Selector string             `json:"selector" bson:"selector"`
+	Hash     string             `json:"hash" bson:"hash"`
+	Expires  primitive.DateTime `json:"expires" bson:"expires"`
+	JKT      string             `json:"jkt" bson:"jkt"`
+	X5TS256  string             `json:"x5t_s256" bson:"x5t_s256"`
+
+	RotatedHash    string             `json:"rotated_hash" bson:"rotated_hash"`
+	RotatedPair    []byte             `json:"rotated_pair" bson:"rotated_pair"`
+	RotatedExpires primitive.DateTime `json:"rotated_expires" bson:"rotated_expires"`
+
+	AccessHash    string             `json:"access_hash" bson:"access_hash"`
+	AccessExpires primitive.DateTime `json:"access_expires" bson:"access_expires"`
 }
 
 func (r Repo) GetTokenByID(ctx context.Context, userID string) (entities.RefreshToken, error) {
 	const fn = "mongo.GetTokenByID"
-	res := r.tokens.FindOne(ctx, bson.M{"_id": userID})
+	return r.findToken(ctx, fn, bson.M{"_id": userID})
+}
+
+func (r Repo) GetTokenBySelector(ctx context.Context, selector string) (entities.RefreshToken, error) {
+	const fn = "mongo.GetTokenBySelector"
+	return r.findToken(ctx, fn, bson.M{"selector": selector})
+}
+
+func (r Repo) findToken(ctx context.Context, fn string, filter bson.M) (entities.RefreshToken, error) {
+	res := r.tokens.FindOne(ctx, filter)
 	if errors.Is(res.Err(), mongo.ErrNoDocuments) {
 		return entities.RefreshToken{}, app.ErrNotFound
 	}
@@ -53,7 +96,28 @@ func (r Repo) GetTokenByID(ctx context.Context, userID string) (entities.Refresh
 	if err := res.Decode(&tok); err != nil {
 		return entities.RefreshToken{}, fmt.Errorf("fn=%s err='%v'", fn, err)
 	}
-	return entities.NewRefresh(userID, tok.Hash, tok.Expires.Time()), nil
+	refresh := entities.NewRefresh(tok.UserID, tok.Hash, tok.Expires.Time())
+	refresh.Selector = tok.Selector
+	refresh.Confirmation = entities.Confirmation{JKT: tok.JKT, X5TS256: tok.X5TS256}
+	if tok.RotatedHash != "" {
+		refresh.Rotated = entities.Rotated{
+			Hash:    tok.RotatedHash,
+			Pair:    tok.RotatedPair,
+			Expires: tok.RotatedExpires.Time().UTC(),
+		}
+	}
+	if tok.AccessHash != "" {
+		refresh.Access = entities.OpaqueAccess{Hash: tok.AccessHash, Expires: tok.AccessExpires.Time().UTC()}
+	}
+	return refresh, nil
+}
+
+func (r Repo) DeleteTokenByID(ctx context.Context, userID string) error {
+	const fn = "mongo.DeleteTokenByID"
+	if _, err := r.tokens.DeleteOne(ctx, bson.M{"_id": userID}); err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
 }
 
 func New(db *mongo.Database) Repo {
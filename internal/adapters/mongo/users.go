@@ -0,0 +1,177 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"jwt-auth/internal/app"
+	"jwt-auth/internal/entities"
+)
+
+type Users struct {
+	users   *mongo.Collection
+	oneTime *mongo.Collection
+}
+
+type user struct {
+	ID           string `bson:"_id"`
+	Email        string `bson:"email"`
+	PasswordHash string `bson:"password_hash"`
+	Verified     bool   `bson:"verified"`
+}
+
+type oneTime struct {
+	UserID  string             `bson:"user_id"`
+	Purpose string             `bson:"purpose"`
+	Hash    string             `bson:"hash"`
+	Expires primitive.DateTime `bson:"expires"`
+}
+
+func oneTimeID(userID string, purpose entities.Purpose) string {
+	return userID + ":" + string(purpose)
+}
+
+func (u Users) CreateUser(ctx context.Context, usr entities.User) error {
+	const fn = "mongo.CreateUser"
+	_, err := u.users.InsertOne(ctx, user{
+		ID:           usr.ID,
+		Email:        usr.Email,
+		PasswordHash: usr.PasswordHash,
+		Verified:     usr.Verified,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return app.ErrAlreadyExists
+	} else if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
+
+func (u Users) findUser(ctx context.Context, fn string, filter bson.M) (entities.User, error) {
+	res := u.users.FindOne(ctx, filter)
+	if errors.Is(res.Err(), mongo.ErrNoDocuments) {
+		return entities.User{}, app.ErrNotFound
+	}
+	if err := res.Err(); err != nil {
+		return entities.User{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	usr := user{}
+	if err := res.Decode(&usr); err != nil {
+		return entities.User{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return entities.User{
+		ID:           usr.ID,
+		Email:        usr.Email,
+		PasswordHash: usr.PasswordHash,
+		Verified:     usr.Verified,
+	}, nil
+}
+
+func (u Users) GetUserByID(ctx context.Context, userID string) (entities.User, error) {
+	return u.findUser(ctx, "mongo.GetUserByID", bson.M{"_id": userID})
+}
+
+func (u Users) GetUserByEmail(ctx context.Context, email string) (entities.User, error) {
+	return u.findUser(ctx, "mongo.GetUserByEmail", bson.M{"email": email})
+}
+
+func (u Users) updateUser(ctx context.Context, fn string, userID string, set bson.D) error {
+	res, err := u.users.UpdateByID(ctx, userID, bson.D{primitive.E{Key: "$set", Value: set}})
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	if res.MatchedCount == 0 {
+		return app.ErrNotFound
+	}
+	return nil
+}
+
+func (u Users) UpdatePassword(ctx context.Context, userID string, hash string) error {
+	return u.updateUser(ctx, "mongo.UpdatePassword", userID, bson.D{
+		primitive.E{Key: "password_hash", Value: hash},
+	})
+}
+
+func (u Users) RehashPassword(ctx context.Context, userID string, prevHash string, hash string) error {
+	const fn = "mongo.RehashPassword"
+	res, err := u.users.UpdateOne(ctx,
+		bson.M{"_id": userID, "password_hash": prevHash},
+		bson.D{primitive.E{Key: "$set", Value: bson.D{primitive.E{Key: "password_hash", Value: hash}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	if res.MatchedCount == 0 {
+		return app.ErrNotFound
+	}
+	return nil
+}
+
+func (u Users) SetVerified(ctx context.Context, userID string) error {
+	return u.updateUser(ctx, "mongo.SetVerified", userID, bson.D{
+		primitive.E{Key: "verified", Value: true},
+	})
+}
+
+func (u Users) CreateOneTimeToken(ctx context.Context, token entities.OneTimeToken) error {
+	const fn = "mongo.CreateOneTimeToken"
+	update := bson.D{
+		primitive.E{
+			Key: "$set",
+			Value: oneTime{
+				UserID:  token.UserID,
+				Purpose: string(token.Purpose),
+				Hash:    token.Hash,
+				Expires: primitive.NewDateTimeFromTime(token.Expires),
+			},
+		},
+	}
+	opts := options.Update().SetUpsert(true)
+	_, err := u.oneTime.UpdateByID(ctx, oneTimeID(token.UserID, token.Purpose), update, opts)
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
+
+func (u Users) GetOneTimeToken(ctx context.Context, userID string, purpose entities.Purpose) (entities.OneTimeToken, error) {
+	const fn = "mongo.GetOneTimeToken"
+	res := u.oneTime.FindOne(ctx, bson.M{"_id": oneTimeID(userID, purpose)})
+	if errors.Is(res.Err(), mongo.ErrNoDocuments) {
+		return entities.OneTimeToken{}, app.ErrNotFound
+	}
+	if err := res.Err(); err != nil {
+		return entities.OneTimeToken{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	tok := oneTime{}
+	if err := res.Decode(&tok); err != nil {
+		return entities.OneTimeToken{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return entities.NewOneTime(userID, purpose, tok.Hash, tok.Expires.Time()), nil
+}
+
+func (u Users) DeleteOneTimeToken(ctx context.Context, token entities.OneTimeToken) error {
+	const fn = "mongo.DeleteOneTimeToken"
+	res, err := u.oneTime.DeleteOne(ctx, bson.M{
+		"_id":  oneTimeID(token.UserID, token.Purpose),
+		"hash": token.Hash,
+	})
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	if res.DeletedCount == 0 {
+		return app.ErrNotFound
+	}
+	return nil
+}
+
+func NewUsers(db *mongo.Database) Users {
+	return Users{
+		users:   db.Collection("users"),
+		oneTime: db.Collection("one_time_tokens"),
+	}
+}
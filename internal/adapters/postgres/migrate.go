@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationsLock is the advisory lock key, so replicas starting together
+// do not apply migrations concurrently
+const migrationsLock = 7265786
+
+type migration struct {
+	version int
+	name    string
+}
+
+func listMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	res := make([]migration, 0, len(files))
+	for _, file := range files {
+		num, _, _ := strings.Cut(strings.TrimPrefix(file, "migrations/"), "_")
+		version, err := strconv.Atoi(num)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration name %q", file)
+		}
+		res = append(res, migration{version: version, name: file})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].version < res[j].version
+	})
+	return res, nil
+}
+
+// Migrate applies embedded migrations which are not recorded in schema_migrations yet
+func Migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	const fn = "postgres.Migrate"
+
+	list, err := listMigrations()
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	err = pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationsLock); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+		if err != nil {
+			return err
+		}
+		for _, m := range list {
+			var applied bool
+			err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", m.version).Scan(&applied)
+			if err != nil {
+				return err
+			}
+			if applied {
+				continue
+			}
+			sql, err := migrations.ReadFile(m.name)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, string(sql)); err != nil {
+				return fmt.Errorf("%s: %w", m.name, err)
+			}
+			if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", m.version); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+CREATE TABLE tokens (
+    user_id  TEXT PRIMARY KEY,
+    hash     TEXT        NOT NULL,
+    expires  TIMESTAMPTZ NOT NULL,
+    jkt      TEXT        NOT NULL DEFAULT '',
+    x5t_s256 TEXT        NOT NULL DEFAULT ''
+);
+
+CREATE INDEX tokens_expires_idx ON tokens (expires);
+
+CREATE TABLE users (
+    id            TEXT PRIMARY KEY,
+    email         TEXT    NOT NULL UNIQUE,
+    password_hash TEXT    NOT NULL,
+    verified      BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE one_time_tokens (
+    user_id TEXT        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    purpose TEXT        NOT NULL,
+    hash    TEXT        NOT NULL,
+    expires TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, purpose)
+);
+
+CREATE INDEX one_time_tokens_expires_idx ON one_time_tokens (expires);
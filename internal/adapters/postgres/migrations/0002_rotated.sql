@@ -0,0 +1,4 @@
+ALTER TABLE tokens
+    ADD COLUMN rotated_hash    TEXT  NOT NULL DEFAULT '',
+    ADD COLUMN rotated_pair    BYTEA,
+    ADD COLUMN rotated_expires TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+ALTER TABLE tokens ADD COLUMN selector TEXT;
+
+CREATE UNIQUE INDEX tokens_selector_idx ON tokens (selector);
@@ -0,0 +1,3 @@
+ALTER TABLE tokens
+    ADD COLUMN access_hash    TEXT NOT NULL DEFAULT '',
+    ADD COLUMN access_expires TIMESTAMPTZ;
@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"jwt-auth/internal/app"
+	"jwt-auth/internal/entities"
+	"time"
+)
+
+type Repo struct {
+	pool *pgxpool.Pool
+}
+
+func (r Repo) CreateOrUpdate(ctx context.Context, token entities.RefreshToken) error {
+	const fn = "postgres.CreateOrUpdate"
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO tokens (user_id, selector, hash, expires, jkt, x5t_s256,
+			rotated_hash, rotated_pair, rotated_expires, access_hash, access_expires)
+		VALUES ($1, $2, $3, $4, $5, $6, '', NULL, NULL, $7, $8)
+		ON CONFLICT (user_id) DO UPDATE
+		SET selector = excluded.selector, hash = excluded.hash, expires = excluded.expires,
+			jkt = excluded.jkt, x5t_s256 = excluded.x5t_s256,
+			rotated_hash = '', rotated_pair = NULL, rotated_expires = NULL,
+			access_hash = excluded.access_hash, access_expires = excluded.access_expires`,
+		token.UserID, selector(token), token.Hash, token.Expires, token.Confirmation.JKT, token.Confirmation.X5TS256,
+		token.Access.Hash, accessExpires(token.Access),
+	)
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
+
+func (r Repo) Rotate(ctx context.Context, prevHash string, token entities.RefreshToken) error {
+	const fn = "postgres.Rotate"
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE tokens SET hash = $2, expires = $3, jkt = $4, x5t_s256 = $5,
+			rotated_hash = $7, rotated_pair = $8, rotated_expires = $9, selector = $10,
+			access_hash = $11, access_expires = $12
+		WHERE user_id = $1 AND hash = $6`,
+		token.UserID, token.Hash, token.Expires, token.Confirmation.JKT, token.Confirmation.X5TS256, prevHash,
+		token.Rotated.Hash, token.Rotated.Pair, rotatedExpires(token.Rotated), selector(token),
+		token.Access.Hash, accessExpires(token.Access),
+	)
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return app.ErrNotFound
+	}
+	return nil
+}
+
+// selector stores the empty selector of the two-token mode as NULL, which the unique index allows to repeat
+func selector(token entities.RefreshToken) *string {
+	if token.Selector == "" {
+		return nil
+	}
+	return &token.Selector
+}
+
+func rotatedExpires(rotated entities.Rotated) *time.Time {
+	if rotated.Hash == "" {
+		return nil
+	}
+	return &rotated.Expires
+}
+
+func accessExpires(access entities.OpaqueAccess) *time.Time {
+	if access.Hash == "" {
+		return nil
+	}
+	return &access.Expires
+}
+
+func (r Repo) GetTokenByID(ctx context.Context, userID string) (entities.RefreshToken, error) {
+	const fn = "postgres.GetTokenByID"
+	return r.findToken(ctx, fn, "user_id", userID)
+}
+
+func (r Repo) GetTokenBySelector(ctx context.Context, selector string) (entities.RefreshToken, error) {
+	const fn = "postgres.GetTokenBySelector"
+	return r.findToken(ctx, fn, "selector", selector)
+}
+
+// findToken selects the session by the value of the unique column
+func (r Repo) findToken(ctx context.Context, fn string, column string, value string) (entities.RefreshToken, error) {
+	var token entities.RefreshToken
+	var rotatedAt, accessAt *time.Time
+	err := r.pool.QueryRow(ctx, `
+		SELECT user_id, COALESCE(selector, ''), hash, expires, jkt, x5t_s256,
+			rotated_hash, rotated_pair, rotated_expires, access_hash, access_expires
+		FROM tokens WHERE `+column+` = $1`, value,
+	).Scan(
+		&token.UserID, &token.Selector, &token.Hash, &token.Expires, &token.Confirmation.JKT, &token.Confirmation.X5TS256,
+		&token.Rotated.Hash, &token.Rotated.Pair, &rotatedAt, &token.Access.Hash, &accessAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.RefreshToken{}, app.ErrNotFound
+	} else if err != nil {
+		return entities.RefreshToken{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	token.Expires = token.Expires.UTC()
+	if rotatedAt != nil {
+		token.Rotated.Expires = rotatedAt.UTC()
+	}
+	if accessAt != nil {
+		token.Access.Expires = accessAt.UTC()
+	}
+	return token, nil
+}
+
+func (r Repo) DeleteTokenByID(ctx context.Context, userID string) error {
+	const fn = "postgres.DeleteTokenByID"
+	if _, err := r.pool.Exec(ctx, "DELETE FROM tokens WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
+
+func New(pool *pgxpool.Pool) Repo {
+	return Repo{pool: pool}
+}
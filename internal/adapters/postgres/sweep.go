@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+// expiredGrace keeps expired sessions for a while, so clients refreshing with an
+// outdated token get "expired" instead of "not found", as in MongoDB
+const expiredGrace = time.Hour
+
+// Sweep removes refresh tokens expired more than expiredGrace before now and expired
+// one-time tokens, as the TTL indexes do in MongoDB. It returns the number of removed rows
+func Sweep(ctx context.Context, pool *pgxpool.Pool, now time.Time) (int, error) {
+	const fn = "postgres.Sweep"
+	removed := 0
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "DELETE FROM tokens WHERE expires < $1", now.Add(-expiredGrace))
+		if err != nil {
+			return err
+		}
+		removed += int(tag.RowsAffected())
+		tag, err = tx.Exec(ctx, "DELETE FROM one_time_tokens WHERE expires < $1", now)
+		if err != nil {
+			return err
+		}
+		removed += int(tag.RowsAffected())
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return removed, nil
+}
+
+// RunSweeper calls Sweep every interval until the context is done. The interval must
+// be positive
+func RunSweeper(ctx context.Context, pool *pgxpool.Pool, interval time.Duration, log *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			removed, err := Sweep(ctx, pool, now.UTC())
+			if err != nil {
+				log.Error("cannot sweep expired tokens", slog.String("error", err.Error()))
+				continue
+			}
+			if removed > 0 {
+				log.Debug("expired tokens swept", slog.Int("removed", removed))
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"jwt-auth/internal/app"
+	"jwt-auth/internal/entities"
+)
+
+const uniqueViolation = "23505"
+
+type Users struct {
+	pool *pgxpool.Pool
+}
+
+func (u Users) CreateUser(ctx context.Context, user entities.User) error {
+	const fn = "postgres.CreateUser"
+	_, err := u.pool.Exec(ctx,
+		"INSERT INTO users (id, email, password_hash, verified) VALUES ($1, $2, $3, $4)",
+		user.ID, user.Email, user.PasswordHash, user.Verified,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return app.ErrAlreadyExists
+	} else if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
+
+func (u Users) findUser(ctx context.Context, fn string, where string, arg string) (entities.User, error) {
+	var user entities.User
+	err := u.pool.QueryRow(ctx, "SELECT id, email, password_hash, verified FROM users WHERE "+where+" = $1", arg).
+		Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Verified)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.User{}, app.ErrNotFound
+	} else if err != nil {
+		return entities.User{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return user, nil
+}
+
+func (u Users) GetUserByID(ctx context.Context, userID string) (entities.User, error) {
+	return u.findUser(ctx, "postgres.GetUserByID", "id", userID)
+}
+
+func (u Users) GetUserByEmail(ctx context.Context, email string) (entities.User, error) {
+	return u.findUser(ctx, "postgres.GetUserByEmail", "email", email)
+}
+
+func (u Users) exec(ctx context.Context, fn string, sql string, args ...any) error {
+	tag, err := u.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return app.ErrNotFound
+	}
+	return nil
+}
+
+func (u Users) UpdatePassword(ctx context.Context, userID string, hash string) error {
+	return u.exec(ctx, "postgres.UpdatePassword", "UPDATE users SET password_hash = $2 WHERE id = $1", userID, hash)
+}
+
+func (u Users) RehashPassword(ctx context.Context, userID string, prevHash string, hash string) error {
+	return u.exec(ctx, "postgres.RehashPassword",
+		"UPDATE users SET password_hash = $3 WHERE id = $1 AND password_hash = $2", userID, prevHash, hash,
+	)
+}
+
+func (u Users) SetVerified(ctx context.Context, userID string) error {
+	return u.exec(ctx, "postgres.SetVerified", "UPDATE users SET verified = TRUE WHERE id = $1", userID)
+}
+
+func (u Users) CreateOneTimeToken(ctx context.Context, token entities.OneTimeToken) error {
+	return u.exec(ctx, "postgres.CreateOneTimeToken", `
+		INSERT INTO one_time_tokens (user_id, purpose, hash, expires)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, purpose) DO UPDATE
+		SET hash = excluded.hash, expires = excluded.expires`,
+		token.UserID, string(token.Purpose), token.Hash, token.Expires,
+	)
+}
+
+func (u Users) GetOneTimeToken(ctx context.Context, userID string, purpose entities.Purpose) (entities.OneTimeToken, error) {
+	const fn = "postgres.GetOneTimeToken"
+	token := entities.OneTimeToken{UserID: userID, Purpose: purpose}
+	err := u.pool.QueryRow(ctx,
+		"SELECT hash, expires FROM one_time_tokens WHERE user_id = $1 AND purpose = $2",
+		userID, string(purpose),
+	).Scan(&token.Hash, &token.Expires)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.OneTimeToken{}, app.ErrNotFound
+	} else if err != nil {
+		return entities.OneTimeToken{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	token.Expires = token.Expires.UTC()
+	return token, nil
+}
+
+func (u Users) DeleteOneTimeToken(ctx context.Context, token entities.OneTimeToken) error {
+	return u.exec(ctx, "postgres.DeleteOneTimeToken",
+		"DELETE FROM one_time_tokens WHERE user_id = $1 AND purpose = $2 AND hash = $3",
+		token.UserID, string(token.Purpose), token.Hash,
+	)
+}
+
+func NewUsers(pool *pgxpool.Pool) Users {
+	return Users{pool: pool}
+}
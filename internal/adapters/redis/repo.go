@@ -0,0 +1,161 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"jwt-auth/internal/app"
+	"jwt-auth/internal/entities"
+	"strconv"
+	"time"
+)
+
+const (
+	keyPrefix      = "jwt-auth:refresh:"
+	selectorPrefix = "jwt-auth:selector:"
+)
+
+// setToken replaces the session and sets its expiration in one step, so a reader
+// never sees a token without TTL. An expiration in the past removes the key
+var setToken = redis.NewScript(`
+redis.call("DEL", KEYS[1])
+redis.call("HSET", KEYS[1], "hash", ARGV[1], "expires", ARGV[2], "jkt", ARGV[3], "x5t_s256", ARGV[4],
+	"selector", ARGV[5], "access_hash", ARGV[6], "access_expires", ARGV[7])
+redis.call("PEXPIREAT", KEYS[1], ARGV[2])
+return 1
+`)
+
+// rotateToken replaces the session only if it still has the previous hash ARGV[1]
+var rotateToken = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "hash") ~= ARGV[1] then
+	return 0
+end
+redis.call("HSET", KEYS[1], "hash", ARGV[2], "expires", ARGV[3], "jkt", ARGV[4], "x5t_s256", ARGV[5],
+	"rotated_hash", ARGV[6], "rotated_pair", ARGV[7], "rotated_expires", ARGV[8], "selector", ARGV[9],
+	"access_hash", ARGV[10], "access_expires", ARGV[11])
+redis.call("PEXPIREAT", KEYS[1], ARGV[3])
+return 1
+`)
+
+// Repo keeps refresh sessions in hashes which Redis removes when they expire
+type Repo struct {
+	client redis.UniversalClient
+}
+
+func key(userID string) string {
+	return keyPrefix + userID
+}
+
+// setSelector indexes the session by its selector. The index key is separate from the
+// session, so in a cluster it may live on another node. It expires with the session and
+// is checked against it on reads, so a stale index is harmless
+func (r Repo) setSelector(ctx context.Context, token entities.RefreshToken) error {
+	if token.Selector == "" {
+		return nil
+	}
+	return r.client.SetArgs(ctx, selectorPrefix+token.Selector, token.UserID, redis.SetArgs{
+		ExpireAt: token.Expires,
+	}).Err()
+}
+
+func (r Repo) CreateOrUpdate(ctx context.Context, token entities.RefreshToken) error {
+	const fn = "redis.CreateOrUpdate"
+	err := setToken.Run(ctx, r.client, []string{key(token.UserID)},
+		token.Hash, token.Expires.UnixMilli(), token.Confirmation.JKT, token.Confirmation.X5TS256, token.Selector,
+		token.Access.Hash, token.Access.Expires.UnixMilli(),
+	).Err()
+	if err == nil {
+		err = r.setSelector(ctx, token)
+	}
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
+
+func (r Repo) Rotate(ctx context.Context, prevHash string, token entities.RefreshToken) error {
+	const fn = "redis.Rotate"
+	rotated, err := rotateToken.Run(ctx, r.client, []string{key(token.UserID)},
+		prevHash, token.Hash, token.Expires.UnixMilli(), token.Confirmation.JKT, token.Confirmation.X5TS256,
+		token.Rotated.Hash, token.Rotated.Pair, token.Rotated.Expires.UnixMilli(), token.Selector,
+		token.Access.Hash, token.Access.Expires.UnixMilli(),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	if rotated == 0 {
+		return app.ErrNotFound
+	}
+	if err := r.setSelector(ctx, token); err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
+
+func (r Repo) GetTokenByID(ctx context.Context, userID string) (entities.RefreshToken, error) {
+	const fn = "redis.GetTokenByID"
+	fields, err := r.client.HGetAll(ctx, key(userID)).Result()
+	if err != nil {
+		return entities.RefreshToken{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	if len(fields) == 0 {
+		return entities.RefreshToken{}, app.ErrNotFound
+	}
+	ms, err := strconv.ParseInt(fields["expires"], 10, 64)
+	if err != nil {
+		return entities.RefreshToken{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	token := entities.NewRefresh(userID, fields["hash"], time.UnixMilli(ms).UTC())
+	token.Selector = fields["selector"]
+	token.Confirmation = entities.Confirmation{JKT: fields["jkt"], X5TS256: fields["x5t_s256"]}
+	if fields["rotated_hash"] != "" {
+		ms, err := strconv.ParseInt(fields["rotated_expires"], 10, 64)
+		if err != nil {
+			return entities.RefreshToken{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+		}
+		token.Rotated = entities.Rotated{
+			Hash:    fields["rotated_hash"],
+			Pair:    []byte(fields["rotated_pair"]),
+			Expires: time.UnixMilli(ms).UTC(),
+		}
+	}
+	if fields["access_hash"] != "" {
+		ms, err := strconv.ParseInt(fields["access_expires"], 10, 64)
+		if err != nil {
+			return entities.RefreshToken{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+		}
+		token.Access = entities.OpaqueAccess{Hash: fields["access_hash"], Expires: time.UnixMilli(ms).UTC()}
+	}
+	return token, nil
+}
+
+func (r Repo) GetTokenBySelector(ctx context.Context, selector string) (entities.RefreshToken, error) {
+	const fn = "redis.GetTokenBySelector"
+	userID, err := r.client.Get(ctx, selectorPrefix+selector).Result()
+	if errors.Is(err, redis.Nil) {
+		return entities.RefreshToken{}, app.ErrNotFound
+	} else if err != nil {
+		return entities.RefreshToken{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	token, err := r.GetTokenByID(ctx, userID)
+	if err != nil {
+		return entities.RefreshToken{}, err
+	}
+	if token.Selector != selector {
+		return entities.RefreshToken{}, app.ErrNotFound
+	}
+	return token, nil
+}
+
+func (r Repo) DeleteTokenByID(ctx context.Context, userID string) error {
+	const fn = "redis.DeleteTokenByID"
+	if err := r.client.Del(ctx, key(userID)).Err(); err != nil {
+		return fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+	return nil
+}
+
+func New(client redis.UniversalClient) Repo {
+	return Repo{client: client}
+}
@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app"
+	"jwt-auth/internal/entities"
+	"testing"
+	"time"
+)
+
+func setup(t *testing.T) (*miniredis.Miniredis, Repo) {
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return srv, New(client)
+}
+
+func TestRepo(t *testing.T) {
+	ctx := context.Background()
+	srv, repo := setup(t)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	_, err := repo.GetTokenByID(ctx, "user")
+	assert.ErrorIs(t, err, app.ErrNotFound)
+
+	token := entities.NewRefresh("user", "hash", now.Add(time.Minute))
+	token.Confirmation = entities.Confirmation{JKT: "jkt", X5TS256: "x5t"}
+	token.Access = entities.OpaqueAccess{Hash: "access-hash", Expires: now.Add(time.Second)}
+	require.NoError(t, repo.CreateOrUpdate(ctx, token))
+	got, err := repo.GetTokenByID(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, token, got)
+	assert.InDelta(t, time.Minute, srv.TTL(key("user")), float64(time.Second), "expiration is set")
+
+	token = entities.NewRefresh("user", "new-hash", now.Add(time.Hour))
+	require.NoError(t, repo.CreateOrUpdate(ctx, token))
+	got, err = repo.GetTokenByID(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, token, got, "session is replaced with confirmation")
+
+	srv.FastForward(2 * time.Hour)
+	_, err = repo.GetTokenByID(ctx, "user")
+	assert.ErrorIs(t, err, app.ErrNotFound, "session expires")
+
+	require.NoError(t, repo.CreateOrUpdate(ctx, entities.NewRefresh("user", "hash", now.Add(time.Minute))))
+	require.NoError(t, repo.DeleteTokenByID(ctx, "user"))
+	_, err = repo.GetTokenByID(ctx, "user")
+	assert.ErrorIs(t, err, app.ErrNotFound, "session is deleted")
+}
+
+func TestRepo_GetTokenBySelector(t *testing.T) {
+	ctx := context.Background()
+	srv, repo := setup(t)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	token := entities.NewRefresh("user", "hash", now.Add(time.Minute))
+	token.Selector = "selector"
+	require.NoError(t, repo.CreateOrUpdate(ctx, token))
+	got, err := repo.GetTokenBySelector(ctx, "selector")
+	require.NoError(t, err)
+	assert.Equal(t, token, got)
+	assert.InDelta(t, time.Minute, srv.TTL(selectorPrefix+"selector"), float64(time.Second), "index expires with the session")
+
+	token.Selector = "next-selector"
+	require.NoError(t, repo.CreateOrUpdate(ctx, token))
+	_, err = repo.GetTokenBySelector(ctx, "selector")
+	assert.ErrorIs(t, err, app.ErrNotFound, "stale index is ignored")
+
+	require.NoError(t, repo.DeleteTokenByID(ctx, "user"))
+	_, err = repo.GetTokenBySelector(ctx, "next-selector")
+	assert.ErrorIs(t, err, app.ErrNotFound)
+}
+
+func TestRepo_Rotate(t *testing.T) {
+	ctx := context.Background()
+	srv, repo := setup(t)
+	exp := time.Now().UTC().Truncate(time.Millisecond).Add(time.Minute)
+
+	assert.ErrorIs(t, repo.Rotate(ctx, "hash", entities.NewRefresh("user", "next", exp)), app.ErrNotFound)
+	require.NoError(t, repo.CreateOrUpdate(ctx, entities.NewRefresh("user", "hash", exp)))
+
+	next := entities.NewRefresh("user", "next", exp.Add(time.Minute))
+	next.Rotated = entities.Rotated{Hash: "hash", Pair: []byte{0, 1, 2}, Expires: exp}
+	require.NoError(t, repo.Rotate(ctx, "hash", next))
+	assert.ErrorIs(t, repo.Rotate(ctx, "hash", entities.NewRefresh("user", "other", exp)), app.ErrNotFound,
+		"session is rotated once")
+	got, err := repo.GetTokenByID(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, next, got)
+	assert.InDelta(t, 2*time.Minute, srv.TTL(key("user")), float64(time.Second), "expiration is moved")
+}
@@ -12,6 +12,7 @@ import (
 	"log/slog"
 	"math/big"
 	"regexp"
+	"strings"
 	"time"
 )
 
@@ -19,6 +20,11 @@ import (
 type Repo interface {
 	CreateOrUpdate(ctx context.Context, token entities.RefreshToken) error
 	GetTokenByID(ctx context.Context, userID string) (entities.RefreshToken, error)
+	GetTokenBySelector(ctx context.Context, selector string) (entities.RefreshToken, error)
+	DeleteTokenByID(ctx context.Context, userID string) error
+	// Rotate replaces the session only if its hash is still prevHash. It returns
+	// ErrNotFound when the session has been rotated or deleted concurrently
+	Rotate(ctx context.Context, prevHash string, token entities.RefreshToken) error
 }
 
 //go:generate go run github.com/vektra/mockery/v2@v2.32.4 --name=Hasher
@@ -27,19 +33,61 @@ type Hasher interface {
 	Compare(ctx context.Context, hash string, token string) error
 }
 
+// Rehasher is implemented by hashers which recognize hashes made by another algorithm
+// or with outdated parameters. Such hashes are replaced after a successful comparison
+type Rehasher interface {
+	NeedsRehash(hash string) bool
+}
+
+func needsRehash(h Hasher, hash string) bool {
+	r, ok := h.(Rehasher)
+	return ok && r.NeedsRehash(hash)
+}
+
 type App struct {
 	repo           Repo
 	hasher         Hasher
 	accessSecret   []byte
 	accessExpires  time.Duration
 	refreshExpires time.Duration
+	users          Users
+	mailer         Mailer
+	resetExpires   time.Duration
+	verifyExpires  time.Duration
+	attempts       AttemptStore
+	lockout        LockoutPolicy
+	replay         ReplayCache
+	refreshGrace   time.Duration
+	tokenHasher    Hasher
+	selectorTokens bool
+	opaqueClients  []string
+	jwe            jweKeys
+	audiences      map[string]bool
+	paseto         pasetoFormat
+}
+
+type Option func(a *App)
+
+// WithTokenHasher sets the hasher of machine-generated tokens: refresh and one-time
+// tokens. It may be fast, as they are random. Passwords are hashed by the main hasher
+func WithTokenHasher(h Hasher) Option {
+	return func(a *App) {
+		a.tokenHasher = h
+	}
+}
+
+func (a App) tokens() Hasher {
+	if a.tokenHasher != nil {
+		return a.tokenHasher
+	}
+	return a.hasher
 }
 
 func randomToken() string {
 	const minLen = 10
 	const maxLen = 72
-	l, _ := rand.Int(rand.Reader, big.NewInt((maxLen-minLen)+minLen))
-	b := make([]byte, l.Int64())
+	l, _ := rand.Int(rand.Reader, big.NewInt(maxLen-minLen+1))
+	b := make([]byte, l.Int64()+minLen)
 	if _, err := rand.Read(b); err != nil {
 		return ""
 	}
@@ -66,35 +114,114 @@ func (a App) GeneratePair(ctx context.Context, userID string) (entities.JWTPair,
 		return entities.JWTPair{}, ErrInvalidUserID
 	}
 
+	selector := ""
+	if a.selectorTokens {
+		selector = newSelector()
+	}
+	return a.issuePair(ctx, userID, selector, func(ctx context.Context, token entities.RefreshToken, _ entities.JWTPair) error {
+		return a.repo.CreateOrUpdate(ctx, token)
+	})
+}
+
+// issuePair generates a new pair and passes the refresh session to store. The pair
+// is returned only if it has been stored. An empty selector makes a two-token mode pair
+func (a App) issuePair(
+	ctx context.Context,
+	userID string,
+	selector string,
+	store func(ctx context.Context, token entities.RefreshToken, pair entities.JWTPair) error,
+) (entities.JWTPair, error) {
+	const fn = "app.issuePair"
+
+	log := logger.Log(ctx).With(
+		slog.String("fn", fn),
+		slog.String("userID", userID),
+	)
+
+	opaque := a.opaqueAccess(ctx)
+	// opaque tokens have no claims, so the audience matters only for signed ones
+	if !opaque {
+		if err := a.checkAudience(audience(ctx)); err != nil {
+			return entities.JWTPair{}, err
+		}
+	}
+	if opaque && selector == "" {
+		// the opaque access token finds the session by the selector
+		selector = newSelector()
+	}
+
 	log.Debug("generating refresh token")
 	now := time.Now().UTC()
 	refresh := randomToken()
-	hashRefresh, err := a.hasher.Generate(ctx, refresh)
+	hashRefresh, err := a.tokens().Generate(ctx, refresh)
 	if err != nil {
 		return entities.JWTPair{}, err
 	}
 	log.Debug("generated", slog.String("token", refresh), slog.String("hash", hashRefresh))
 
-	err = a.repo.CreateOrUpdate(ctx, entities.NewRefresh(userID, hashRefresh, now.Add(a.refreshExpires)))
+	cnf := confirmation(ctx)
+	token := entities.NewRefresh(userID, hashRefresh, now.Add(a.refreshExpires))
+	token.Selector = selector
+	token.Confirmation = cnf
+
+	log.Debug("generating access token", slog.Bool("opaque", opaque))
+	var strAccess string
+	if opaque {
+		var hashAccess string
+		strAccess, hashAccess, err = newOpaqueAccess(selector)
+		token.Access = entities.OpaqueAccess{Hash: hashAccess, Expires: now.Add(a.accessExpires)}
+	} else {
+		strAccess, err = a.signAccess(userID, audience(ctx), cnf, now)
+	}
 	if err != nil {
+		return entities.JWTPair{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+	}
+
+	pair := entities.NewPair(strAccess, formatRefresh(selector, refresh))
+	pair.AccessExpires = now.Add(a.accessExpires)
+	pair.RefreshExpires = token.Expires
+	if cnf.JKT != "" {
+		pair.TokenType = entities.TokenTypeDPoP
+	}
+	if err := store(ctx, token, pair); err != nil {
 		return entities.JWTPair{}, err
 	}
+	return pair, nil
+}
 
-	log.Debug("generating access token")
-	access := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+// signAccess issues the access token in the configured format. A JWT is encrypted
+// if the audience has a JWE key
+func (a App) signAccess(userID string, aud string, cnf entities.Confirmation, now time.Time) (string, error) {
+	if a.paseto.enabled() {
+		return a.paseto.sign(userID, aud, cnf, now, now.Add(a.accessExpires))
+	}
+	claims := jwt.MapClaims{
 		"sub": userID,
 		"exp": now.Add(a.accessExpires).Unix(),
-	})
-	strAccess, err := access.SignedString(a.accessSecret)
+	}
+	if aud != "" {
+		claims["aud"] = aud
+	}
+	if cnfClaim := confirmationClaim(cnf); len(cnfClaim) > 0 {
+		claims["cnf"] = cnfClaim
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(a.accessSecret)
 	if err != nil {
-		return entities.JWTPair{}, fmt.Errorf("fn=%s err='%v'", fn, err)
+		return "", err
 	}
-
-	b64Refresh := base64.StdEncoding.EncodeToString([]byte(refresh))
-	return entities.NewPair(strAccess, b64Refresh), nil
+	return a.jwe.encrypt(aud, signed)
 }
 
-func decodeToken(secret []byte, tokenString string) (jwt.MapClaims, error) {
+// decodeToken verifies the token, decrypting it first if it is a JWE one
+func decodeToken(secret []byte, keys jweKeys, tokenString string) (jwt.MapClaims, error) {
+	// a JWE token in the compact serialization has five segments
+	if strings.Count(tokenString, ".") == 4 {
+		signed, err := keys.decrypt(tokenString)
+		if err != nil {
+			return nil, err
+		}
+		tokenString = signed
+	}
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, ErrIncorrectToken
@@ -113,51 +240,142 @@ func decodeToken(secret []byte, tokenString string) (jwt.MapClaims, error) {
 	return nil, err
 }
 
-func (a App) Refresh(ctx context.Context, access string, b64Refresh string) (entities.JWTPair, error) {
-	const fn = "app.Refresh"
-
-	log := logger.Log(ctx).With(slog.String("fn", fn))
-	log.Debug("decoding", slog.String("refresh_in_base64", b64Refresh), slog.String("access", access))
-	refresh, err := base64.StdEncoding.DecodeString(b64Refresh)
-	if err != nil {
-		return entities.JWTPair{}, ErrIncorrectToken
+// decodeAccess verifies the access token of the configured format. Tokens of another
+// format are not accepted, so a JWT can't be passed where PASETO is expected
+func (a App) decodeAccess(access string) (jwt.MapClaims, error) {
+	if a.paseto.enabled() {
+		return a.paseto.parse(access)
 	}
+	return decodeToken(a.accessSecret, a.jwe, access)
+}
 
-	claims, err := decodeToken(a.accessSecret, access)
+// Subject returns the user ID of the correctly signed access token. Expired tokens are accepted
+func (a App) Subject(_ context.Context, access string) (string, error) {
+	claims, err := a.decodeAccess(access)
 	if err != nil && !errors.Is(err, jwt.ErrTokenExpired) {
 		if errors.Is(err, jwt.ErrTokenMalformed) {
-			return entities.JWTPair{}, ErrIncorrectToken
+			return "", ErrIncorrectToken
 		}
-		return entities.JWTPair{}, err
+		return "", err
 	}
 	userID, ok := claims["sub"].(string)
 	if !ok {
+		return "", ErrIncorrectToken
+	}
+	return userID, nil
+}
+
+// session finds the refresh session by the selector or, for tokens of the two-token mode,
+// by the subject of the access token. Attempts of the user are checked as well
+func (a App) session(ctx context.Context, access string, selector string) (entities.RefreshToken, error) {
+	if selector != "" {
+		token, err := a.repo.GetTokenBySelector(ctx, selector)
+		if err != nil {
+			return entities.RefreshToken{}, err
+		}
+		return token, a.checkAttempts(ctx, userKey(token.UserID))
+	}
+	userID, err := a.Subject(ctx, access)
+	if err != nil {
+		return entities.RefreshToken{}, err
+	}
+	if err := a.checkAttempts(ctx, userKey(userID)); err != nil {
+		return entities.RefreshToken{}, err
+	}
+	return a.repo.GetTokenByID(ctx, userID)
+}
+
+// Refresh rotates the pair. The access token is needed only for refresh tokens without
+// a selector, expired access tokens are accepted
+func (a App) Refresh(ctx context.Context, access string, refreshToken string) (entities.JWTPair, error) {
+	const fn = "app.Refresh"
+
+	log := logger.Log(ctx).With(slog.String("fn", fn))
+	selector, b64Refresh := splitRefresh(refreshToken)
+	log.Debug("decoding", slog.String("refresh_in_base64", b64Refresh), slog.String("access", access))
+	refresh, err := base64.StdEncoding.DecodeString(b64Refresh)
+	if err != nil {
 		return entities.JWTPair{}, ErrIncorrectToken
 	}
 
-	token, err := a.repo.GetTokenByID(ctx, userID)
+	token, err := a.session(ctx, access, selector)
 	if err != nil {
 		return entities.JWTPair{}, err
 	}
+	userID := token.UserID
 	if token.Expires.Before(time.Now().UTC()) {
 		return entities.JWTPair{}, ErrExpired
 	}
+	// the bound session can be refreshed only with a proof of the same key or certificate
+	if !confirms(token.Confirmation, confirmation(ctx)) {
+		return entities.JWTPair{}, ErrPermissionDenied
+	}
 
 	log.Debug("comparing")
-	err = a.hasher.Compare(ctx, token.Hash, string(refresh))
-	if err != nil {
+	err = a.tokens().Compare(ctx, token.Hash, string(refresh))
+	if errors.Is(err, ErrPermissionDenied) && a.refreshGrace > 0 && token.Rotated.Hash != "" {
+		// the token may have been replaced by a parallel refresh of the same client
+		if a.tokens().Compare(ctx, token.Rotated.Hash, string(refresh)) == nil {
+			if pair, ok := a.rotatedPair(token, refresh); ok {
+				log.Debug("returning pair of the rotation within grace period")
+				return pair, nil
+			}
+		}
+	}
+	if err := a.recordAttempt(ctx, userKey(userID), err); err != nil {
 		return entities.JWTPair{}, err
 	}
-	log.Debug("generating new pair")
-	return a.GeneratePair(ctx, userID)
+
+	log.Debug("rotating pair")
+	selector = token.Selector
+	if selector == "" && a.selectorTokens {
+		// sessions of the two-token mode switch to selector tokens on refresh
+		selector = newSelector()
+	}
+	// only one of concurrent refreshes with the same token replaces the session
+	pair, err := a.issuePair(ctx, userID, selector, func(ctx context.Context, next entities.RefreshToken, pair entities.JWTPair) error {
+		if a.refreshGrace > 0 {
+			sealed, err := sealPair(userID, refresh, pair)
+			if err != nil {
+				return fmt.Errorf("fn=%s err='%v'", fn, err)
+			}
+			next.Rotated = entities.Rotated{
+				Hash:    token.Hash,
+				Pair:    sealed,
+				Expires: time.Now().UTC().Add(a.refreshGrace),
+			}
+		}
+		err := a.repo.Rotate(ctx, token.Hash, next)
+		if errors.Is(err, ErrNotFound) {
+			return ErrPermissionDenied
+		}
+		return err
+	})
+	if errors.Is(err, ErrPermissionDenied) && a.refreshGrace > 0 {
+		// the parallel refresh which has won may have left the pair for this token
+		current, getErr := a.repo.GetTokenByID(ctx, userID)
+		if getErr == nil && current.Rotated.Hash == token.Hash {
+			if pair, ok := a.rotatedPair(current, refresh); ok {
+				log.Debug("returning pair of the concurrent rotation")
+				return pair, nil
+			}
+		}
+	}
+	return pair, err
 }
 
-func New(repo Repo, hasher Hasher, accessSecret string, accessExpires time.Duration, refreshExpires time.Duration) App {
-	return App{
+func New(repo Repo, hasher Hasher, accessSecret string, accessExpires time.Duration, refreshExpires time.Duration, opts ...Option) App {
+	a := App{
 		repo:           repo,
 		hasher:         hasher,
 		accessSecret:   []byte(accessSecret),
 		accessExpires:  accessExpires,
 		refreshExpires: refreshExpires,
+		resetExpires:   time.Hour,
+		verifyExpires:  24 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(&a)
 	}
+	return a
 }
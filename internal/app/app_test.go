@@ -68,7 +68,7 @@ func repoGetTokenByID(t *testing.T, hash string, exp time.Time) Repo {
 	return r
 }
 
-func repoGetTokenByIDCreateOrUpdate(t *testing.T, hash string, exp time.Time) Repo {
+func repoGetTokenByIDRotate(t *testing.T, hash string, exp time.Time, rotateErr error) Repo {
 	r := mocks.NewRepo(t)
 	r.
 		On("GetTokenByID", mock.Anything, mock.AnythingOfType("string")).
@@ -76,8 +76,8 @@ func repoGetTokenByIDCreateOrUpdate(t *testing.T, hash string, exp time.Time) Re
 			return entities.RefreshToken{UserID: userID, Hash: hash, Expires: exp}, nil
 		})
 	r.
-		On("CreateOrUpdate", mock.Anything, mock.AnythingOfType("entities.RefreshToken")).
-		Return(nil)
+		On("Rotate", mock.Anything, hash, mock.AnythingOfType("entities.RefreshToken")).
+		Return(rotateErr)
 
 	return r
 }
@@ -91,6 +91,21 @@ func repoCreateOrUpdate(t *testing.T) Repo {
 	return r
 }
 
+// TestRandomToken checks the length range of refresh tokens: at least 10 bytes to be
+// unguessable and at most 72, which bcrypt hashes. The length is random, so it is drawn
+// enough times to reach both bounds
+func TestRandomToken(t *testing.T) {
+	lengths := make(map[int]bool)
+	for i := 0; i < 5000; i++ {
+		l := len(randomToken())
+		require.GreaterOrEqual(t, l, 10)
+		require.LessOrEqual(t, l, 72)
+		lengths[l] = true
+	}
+	assert.True(t, lengths[10], "the shortest length is drawn")
+	assert.True(t, lengths[72], "the longest length is drawn")
+}
+
 func TestApp_GeneratePair(t *testing.T) {
 	type fields struct {
 		repo           Repo
@@ -125,7 +140,7 @@ func TestApp_GeneratePair(t *testing.T) {
 			},
 			want: func(t assert.TestingT, i interface{}, i2 ...interface{}) bool {
 				p, _ := i.(entities.JWTPair)
-				claims, err := decodeToken(accessSecret, p.Access)
+				claims, err := decodeToken(accessSecret, nil, p.Access)
 				return assert.NoError(t, err) && assert.Equal(t, userIDDefault, claims["sub"].(string))
 			},
 			wantErr: nil,
@@ -145,7 +160,7 @@ func TestApp_GeneratePair(t *testing.T) {
 			},
 			want: func(t assert.TestingT, i interface{}, i2 ...interface{}) bool {
 				p, _ := i.(entities.JWTPair)
-				_, err := decodeToken(accessSecret, p.Access)
+				_, err := decodeToken(accessSecret, nil, p.Access)
 				return assert.ErrorIs(t, err, jwt.ErrTokenExpired)
 			},
 			wantErr: nil,
@@ -229,7 +244,7 @@ func TestApp_Refresh(t *testing.T) {
 		{
 			name: "correct refreshing",
 			fields: fields{
-				repo:           repoGetTokenByIDCreateOrUpdate(t, refreshHash, now.Add(time.Minute)),
+				repo:           repoGetTokenByIDRotate(t, refreshHash, now.Add(time.Minute), nil),
 				hasher:         hasherCompareGenerate(t),
 				accessSecret:   accessSecret,
 				accessExpires:  time.Minute,
@@ -242,7 +257,7 @@ func TestApp_Refresh(t *testing.T) {
 			},
 			want: func(t assert.TestingT, i interface{}, i2 ...interface{}) bool {
 				p, _ := i.(entities.JWTPair)
-				claims, err := decodeToken(accessSecret, p.Access)
+				claims, err := decodeToken(accessSecret, nil, p.Access)
 				return assert.NoError(t, err) && assert.Equal(t, userIDDefault, claims["sub"].(string))
 			},
 			wantErr: nil,
@@ -265,6 +280,24 @@ func TestApp_Refresh(t *testing.T) {
 				return assert.ErrorIs(t, ErrPermissionDenied, err)
 			},
 		},
+		{
+			name: "concurrent refresh has rotated the session",
+			fields: fields{
+				repo:           repoGetTokenByIDRotate(t, refreshHash, now.Add(time.Minute), ErrNotFound),
+				hasher:         hasherCompareGenerate(t),
+				accessSecret:   accessSecret,
+				accessExpires:  time.Minute,
+				refreshExpires: time.Minute,
+			},
+			args: args{
+				ctx:     ctx,
+				access:  accCorrect,
+				refresh: refresh,
+			},
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrPermissionDenied)
+			},
+		},
 		{
 			name: "user not found",
 			fields: fields{
@@ -322,7 +355,7 @@ func TestApp_Refresh(t *testing.T) {
 		{
 			name: "access token expired",
 			fields: fields{
-				repo:           repoGetTokenByIDCreateOrUpdate(t, refreshHash, now.Add(time.Minute)),
+				repo:           repoGetTokenByIDRotate(t, refreshHash, now.Add(time.Minute), nil),
 				hasher:         hasherCompareGenerate(t),
 				accessSecret:   accessSecret,
 				accessExpires:  time.Minute,
@@ -335,7 +368,7 @@ func TestApp_Refresh(t *testing.T) {
 			},
 			want: func(t assert.TestingT, i interface{}, i2 ...interface{}) bool {
 				p, _ := i.(entities.JWTPair)
-				claims, err := decodeToken(accessSecret, p.Access)
+				claims, err := decodeToken(accessSecret, nil, p.Access)
 				return assert.NoError(t, err) && assert.Equal(t, userIDDefault, claims["sub"].(string))
 			},
 			wantErr: nil,
@@ -360,3 +393,11 @@ func TestApp_Refresh(t *testing.T) {
 		})
 	}
 }
+
+func TestApp_GeneratePair_tokenHasher(t *testing.T) {
+	a := New(repoCreateOrUpdate(t), mocks.NewHasher(t), string(accessSecret), time.Minute, time.Minute,
+		WithTokenHasher(hasherGenerate(t)),
+	)
+	_, err := a.GeneratePair(ctx, userIDDefault)
+	require.NoError(t, err, "refresh token is hashed by the token hasher")
+}
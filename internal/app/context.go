@@ -0,0 +1,53 @@
+package app
+
+import (
+	"context"
+	"jwt-auth/internal/entities"
+)
+
+// Keys of request-scoped values which are stored in the context by the transport layer
+const (
+	CtxClientIP = "client_ip"
+	CtxClientID = "client_id"
+	CtxDPoPJKT  = "dpop_jkt"
+	CtxX5TS256  = "x5t_s256"
+	CtxAudience = "audience"
+)
+
+func clientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(CtxClientIP).(string)
+	return ip
+}
+
+func audience(ctx context.Context) string {
+	aud, _ := ctx.Value(CtxAudience).(string)
+	return aud
+}
+
+func confirmation(ctx context.Context) entities.Confirmation {
+	jkt, _ := ctx.Value(CtxDPoPJKT).(string)
+	x5t, _ := ctx.Value(CtxX5TS256).(string)
+	return entities.Confirmation{JKT: jkt, X5TS256: x5t}
+}
+
+func confirmationClaim(cnf entities.Confirmation) map[string]string {
+	claim := make(map[string]string)
+	if cnf.JKT != "" {
+		claim["jkt"] = cnf.JKT
+	}
+	if cnf.X5TS256 != "" {
+		claim["x5t#S256"] = cnf.X5TS256
+	}
+	return claim
+}
+
+// confirms checks that the presenter holds every key the session is bound to
+func confirms(bound entities.Confirmation, presented entities.Confirmation) bool {
+	if bound.JKT != "" && bound.JKT != presented.JKT {
+		return false
+	}
+	if bound.X5TS256 != "" && bound.X5TS256 != presented.X5TS256 {
+		return false
+	}
+	return true
+}
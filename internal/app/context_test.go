@@ -0,0 +1,47 @@
+package app
+
+import (
+	"github.com/stretchr/testify/assert"
+	"jwt-auth/internal/entities"
+	"testing"
+)
+
+func TestConfirms(t *testing.T) {
+	tests := []struct {
+		name      string
+		bound     entities.Confirmation
+		presented entities.Confirmation
+		want      bool
+	}{
+		{
+			name: "unbound session",
+			want: true,
+		},
+		{
+			name:      "unbound session with a key",
+			presented: entities.Confirmation{JKT: "jkt", X5TS256: "x5t"},
+			want:      true,
+		},
+		{
+			name:      "same certificate",
+			bound:     entities.Confirmation{X5TS256: "x5t"},
+			presented: entities.Confirmation{X5TS256: "x5t"},
+			want:      true,
+		},
+		{
+			name:      "another certificate",
+			bound:     entities.Confirmation{X5TS256: "x5t"},
+			presented: entities.Confirmation{X5TS256: "another"},
+		},
+		{
+			name:      "certificate is missing",
+			bound:     entities.Confirmation{JKT: "jkt", X5TS256: "x5t"},
+			presented: entities.Confirmation{JKT: "jkt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, confirms(tt.bound, tt.presented))
+		})
+	}
+}
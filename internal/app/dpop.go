@@ -0,0 +1,113 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"jwt-auth/internal/logger"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//go:generate go run github.com/vektra/mockery/v2@v2.32.4 --name=ReplayCache
+type ReplayCache interface {
+	// Add remembers the ID until it expires. It returns false if the ID is already known
+	Add(ctx context.Context, id string, expires time.Time) (bool, error)
+}
+
+const (
+	// dpopLifetime is how long a DPoP proof is accepted after it was issued
+	dpopLifetime = 2 * time.Minute
+	// dpopLeeway allows proofs from clients with clocks slightly ahead
+	dpopLeeway = 30 * time.Second
+)
+
+var dpopMethods = []string{
+	"ES256", "ES384", "ES512",
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"EdDSA",
+}
+
+// WithDPoP enables sender-constrained tokens (RFC 9449). Proof IDs are kept in
+// the cache to reject replayed proofs
+func WithDPoP(cache ReplayCache) Option {
+	return func(a *App) {
+		a.replay = cache
+	}
+}
+
+// normalizeHTU drops the query and the fragment and lowercases the scheme and the host
+func normalizeHTU(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	host := strings.ToLower(u.Host)
+	if (u.Scheme == "https" && u.Port() == "443") || (u.Scheme == "http" && u.Port() == "80") {
+		host = strings.ToLower(u.Hostname())
+	}
+	return strings.ToLower(u.Scheme) + "://" + host + u.EscapedPath(), nil
+}
+
+// VerifyDPoP validates the DPoP proof JWT received with the request to htu using
+// the htm method and returns the JWK thumbprint of the proof key
+func (a App) VerifyDPoP(ctx context.Context, proof string, htm string, htu string) (string, error) {
+	const fn = "app.VerifyDPoP"
+
+	if a.replay == nil {
+		return "", ErrUnsupported
+	}
+	log := logger.Log(ctx).With(slog.String("fn", fn))
+
+	var key jwk
+	token, err := jwt.Parse(proof, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, fmt.Errorf("unexpected type %q", typ)
+		}
+		var err error
+		if key, err = parseJWK(token.Header["jwk"]); err != nil {
+			return nil, err
+		}
+		return key.publicKey()
+	}, jwt.WithValidMethods(dpopMethods))
+	if err != nil {
+		log.Debug("invalid proof", slog.String("error", err.Error()))
+		return "", ErrInvalidProof
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", ErrInvalidProof
+	}
+
+	jti, _ := claims["jti"].(string)
+	method, _ := claims["htm"].(string)
+	target, _ := claims["htu"].(string)
+	iat, err := claims.GetIssuedAt()
+	if jti == "" || method != htm || err != nil || iat == nil {
+		return "", ErrInvalidProof
+	}
+	want, err := normalizeHTU(htu)
+	if err != nil {
+		return "", err
+	}
+	if got, err := normalizeHTU(target); err != nil || got != want {
+		return "", ErrInvalidProof
+	}
+	now := time.Now().UTC()
+	if iat.Before(now.Add(-dpopLifetime)) || iat.After(now.Add(dpopLeeway)) {
+		return "", ErrInvalidProof
+	}
+
+	added, err := a.replay.Add(ctx, jti, iat.Add(dpopLifetime+dpopLeeway))
+	if err != nil {
+		return "", err
+	}
+	if !added {
+		log.Debug("replayed proof", slog.String("jti", jti))
+		return "", ErrInvalidProof
+	}
+	return key.thumbprint(), nil
+}
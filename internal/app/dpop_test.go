@@ -0,0 +1,194 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app/mocks"
+	"jwt-auth/internal/entities"
+	"testing"
+	"time"
+)
+
+const htu = "https://auth.example.com/api/refresh"
+
+func ecJWK(key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func dpopProof(key *ecdsa.PrivateKey, claims jwt.MapClaims) string {
+	proof := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	proof.Header["typ"] = "dpop+jwt"
+	proof.Header["jwk"] = ecJWK(key)
+	res, _ := proof.SignedString(key)
+	return res
+}
+
+func proofClaims(jti string, htm string, iat time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"jti": jti,
+		"htm": htm,
+		"htu": htu + "?query=ignored",
+		"iat": iat.Unix(),
+	}
+}
+
+func replayCache(t *testing.T, added bool) ReplayCache {
+	r := mocks.NewReplayCache(t)
+	r.
+		On("Add", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+		Return(added, nil)
+	return r
+}
+
+func TestJWK_thumbprint(t *testing.T) {
+	// example from RFC 7638, section 3.1
+	key := jwk{
+		Kty: "RSA",
+		E:   "AQAB",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMs" +
+			"tn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5" +
+			"hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	}
+	_, err := key.publicKey()
+	require.NoError(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", key.thumbprint())
+}
+
+func TestApp_VerifyDPoP(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	wantJKT := jwk{Kty: "EC", Crv: "P-256", X: ecJWK(key)["x"], Y: ecJWK(key)["y"]}.thumbprint()
+
+	hmacProof := jwt.NewWithClaims(jwt.SigningMethodHS256, proofClaims("id", "PUT", now))
+	hmacProof.Header["typ"] = "dpop+jwt"
+	hmacProof.Header["jwk"] = ecJWK(key)
+	strHMACProof, _ := hmacProof.SignedString([]byte("secret"))
+
+	tests := []struct {
+		name    string
+		replay  ReplayCache
+		proof   string
+		wantErr error
+	}{
+		{
+			name:   "correct proof",
+			replay: replayCache(t, true),
+			proof:  dpopProof(key, proofClaims("id", "PUT", now)),
+		},
+		{
+			name:    "replayed proof",
+			replay:  replayCache(t, false),
+			proof:   dpopProof(key, proofClaims("id", "PUT", now)),
+			wantErr: ErrInvalidProof,
+		},
+		{
+			name:    "another method",
+			replay:  mocks.NewReplayCache(t),
+			proof:   dpopProof(key, proofClaims("id", "POST", now)),
+			wantErr: ErrInvalidProof,
+		},
+		{
+			name:    "outdated proof",
+			replay:  mocks.NewReplayCache(t),
+			proof:   dpopProof(key, proofClaims("id", "PUT", now.Add(-time.Hour))),
+			wantErr: ErrInvalidProof,
+		},
+		{
+			name:    "proof without jti",
+			replay:  mocks.NewReplayCache(t),
+			proof:   dpopProof(key, proofClaims("", "PUT", now)),
+			wantErr: ErrInvalidProof,
+		},
+		{
+			name:    "symmetric algorithm",
+			replay:  mocks.NewReplayCache(t),
+			proof:   strHMACProof,
+			wantErr: ErrInvalidProof,
+		},
+		{
+			name:    "DPoP is disabled",
+			proof:   dpopProof(key, proofClaims("id", "PUT", now)),
+			wantErr: ErrUnsupported,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := App{replay: tt.replay}
+			got, err := a.VerifyDPoP(ctx, tt.proof, "PUT", htu)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, wantJKT, got)
+		})
+	}
+}
+
+func TestApp_Refresh_dpop(t *testing.T) {
+	access := generateAccess(userIDDefault, time.Now().UTC().Add(time.Minute))
+	refresh := base64.StdEncoding.EncodeToString([]byte(randomToken()))
+	boundRepo := func(t *testing.T, jkt string) *mocks.Repo {
+		r := mocks.NewRepo(t)
+		r.
+			On("GetTokenByID", mock.Anything, userIDDefault).
+			Return(entities.RefreshToken{
+				UserID:       userIDDefault,
+				Hash:         "hash",
+				Expires:      time.Now().UTC().Add(time.Minute),
+				Confirmation: entities.Confirmation{JKT: jkt},
+			}, nil)
+		return r
+	}
+	//nolint:all
+	proofCtx := func(jkt string) context.Context {
+		return context.WithValue(ctx, CtxDPoPJKT, jkt)
+	}
+
+	t.Run("bound session keeps the key", func(t *testing.T) {
+		r := boundRepo(t, "thumbprint")
+		r.
+			On("Rotate", mock.Anything, "hash", mock.MatchedBy(func(tok entities.RefreshToken) bool {
+				return tok.Confirmation.JKT == "thumbprint"
+			})).
+			Return(nil).
+			Once()
+		a := App{
+			repo:           r,
+			hasher:         hasherCompareGenerate(t),
+			accessSecret:   accessSecret,
+			accessExpires:  time.Minute,
+			refreshExpires: time.Minute,
+		}
+		pair, err := a.Refresh(proofCtx("thumbprint"), access, refresh)
+		require.NoError(t, err)
+		claims, err := decodeToken(accessSecret, nil, pair.Access)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"jkt": "thumbprint"}, claims["cnf"])
+	})
+
+	for _, jkt := range []string{"", "another-thumbprint"} {
+		t.Run(fmt.Sprintf("bound session with key %q", jkt), func(t *testing.T) {
+			a := App{
+				repo:         boundRepo(t, "thumbprint"),
+				accessSecret: accessSecret,
+			}
+			_, err := a.Refresh(proofCtx(jkt), access, refresh)
+			require.ErrorIs(t, err, ErrPermissionDenied)
+		})
+	}
+}
@@ -8,4 +8,13 @@ var (
 	ErrExpired          = errors.New("token has been expired")
 	ErrInvalidUserID    = errors.New("invalid user ID")
 	ErrIncorrectToken   = errors.New("incorrect token data")
+	ErrAlreadyExists    = errors.New("already exists")
+	ErrInvalidEmail     = errors.New("invalid email")
+	ErrInvalidPassword  = errors.New("password must be from 8 to 72 bytes long")
+	ErrUnsupported      = errors.New("operation is not supported")
+	ErrTooManyAttempts  = errors.New("too many failed attempts, try again later")
+	ErrAccountLocked    = errors.New("account is temporarily locked")
+	ErrInvalidIP        = errors.New("invalid IP address")
+	ErrInvalidProof     = errors.New("invalid DPoP proof")
+	ErrInvalidAudience  = errors.New("unknown audience")
 )
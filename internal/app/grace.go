@@ -0,0 +1,99 @@
+package app
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"jwt-auth/internal/entities"
+	"time"
+)
+
+const graceInfo = "jwt-auth refresh grace"
+
+// WithRefreshGrace lets the refresh token replaced less than grace ago get the same
+// new pair again, so parallel refreshes from one client do not log it out
+func WithRefreshGrace(grace time.Duration) Option {
+	return func(a *App) {
+		a.refreshGrace = grace
+	}
+}
+
+// graceAEAD derives the key from the replaced refresh token, so the stored pair
+// can be read only by the client that presents it
+func graceAEAD(userID string, refresh []byte) (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, refresh, []byte(userID), []byte(graceInfo)), key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+type sealedPair struct {
+	Access         string    `json:"access"`
+	Refresh        string    `json:"refresh"`
+	TokenType      string    `json:"token_type,omitempty"`
+	AccessExpires  time.Time `json:"access_expires,omitempty"`
+	RefreshExpires time.Time `json:"refresh_expires,omitempty"`
+}
+
+func sealPair(userID string, refresh []byte, pair entities.JWTPair) ([]byte, error) {
+	aead, err := graceAEAD(userID, refresh)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := json.Marshal(sealedPair{
+		Access:         pair.Access,
+		Refresh:        pair.Refresh,
+		TokenType:      pair.TokenType,
+		AccessExpires:  pair.AccessExpires,
+		RefreshExpires: pair.RefreshExpires,
+	})
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, []byte(userID)), nil
+}
+
+func openPair(userID string, refresh []byte, sealed []byte) (entities.JWTPair, bool) {
+	aead, err := graceAEAD(userID, refresh)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return entities.JWTPair{}, false
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(userID))
+	if err != nil {
+		return entities.JWTPair{}, false
+	}
+	var pair sealedPair
+	if err := json.Unmarshal(plain, &pair); err != nil {
+		return entities.JWTPair{}, false
+	}
+	res := entities.NewPair(pair.Access, pair.Refresh)
+	if pair.TokenType != "" {
+		// pairs sealed before the metadata was added have only the tokens
+		res.TokenType = pair.TokenType
+	}
+	res.AccessExpires = pair.AccessExpires
+	res.RefreshExpires = pair.RefreshExpires
+	return res, true
+}
+
+// rotatedPair returns the pair issued when the presented token was replaced, if the
+// grace period has not passed. The hash of the presented token is checked by the caller
+func (a App) rotatedPair(token entities.RefreshToken, refresh []byte) (entities.JWTPair, bool) {
+	if a.refreshGrace == 0 || token.Rotated.Hash == "" || time.Now().UTC().After(token.Rotated.Expires) {
+		return entities.JWTPair{}, false
+	}
+	return openPair(token.UserID, refresh, token.Rotated.Pair)
+}
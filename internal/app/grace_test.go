@@ -0,0 +1,109 @@
+package app
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app/mocks"
+	"jwt-auth/internal/entities"
+	"testing"
+	"time"
+)
+
+func TestSealPair(t *testing.T) {
+	pair := entities.NewPair("access", "refresh")
+	pair.TokenType = entities.TokenTypeDPoP
+	pair.AccessExpires = time.Now().UTC().Add(time.Minute).Truncate(time.Second)
+	pair.RefreshExpires = time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	sealed, err := sealPair(userIDDefault, []byte("old-refresh"), pair)
+	require.NoError(t, err)
+
+	got, ok := openPair(userIDDefault, []byte("old-refresh"), sealed)
+	require.True(t, ok)
+	assert.Equal(t, pair, got)
+
+	_, ok = openPair(userIDDefault, []byte("another-refresh"), sealed)
+	assert.False(t, ok, "another refresh token")
+	_, ok = openPair(userIDNotFound, []byte("old-refresh"), sealed)
+	assert.False(t, ok, "another user")
+}
+
+func TestApp_Refresh_grace(t *testing.T) {
+	access := generateAccess(userIDDefault, time.Now().UTC().Add(time.Minute))
+	refresh := randomToken()
+	b64Refresh := base64.StdEncoding.EncodeToString([]byte(refresh))
+	issued := entities.NewPair("issued-access", "issued-refresh")
+	sealed, err := sealPair(userIDDefault, []byte(refresh), issued)
+	require.NoError(t, err)
+
+	rotatedToken := func(graceEnds time.Time) entities.RefreshToken {
+		return entities.RefreshToken{
+			UserID:  userIDDefault,
+			Hash:    "current-hash",
+			Expires: time.Now().UTC().Add(time.Minute),
+			Rotated: entities.Rotated{Hash: "old-hash", Pair: sealed, Expires: graceEnds},
+		}
+	}
+	hasher := func(t *testing.T) *mocks.Hasher {
+		h := mocks.NewHasher(t)
+		h.On("Compare", mock.Anything, "current-hash", refresh).Return(ErrPermissionDenied)
+		h.On("Compare", mock.Anything, "old-hash", refresh).Return(nil)
+		return h
+	}
+
+	t.Run("replaced token within grace period", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetTokenByID", mock.Anything, userIDDefault).Return(rotatedToken(time.Now().UTC().Add(time.Minute)), nil)
+		a := App{repo: r, hasher: hasher(t), accessSecret: accessSecret, refreshGrace: time.Minute}
+
+		pair, err := a.Refresh(ctx, access, b64Refresh)
+		require.NoError(t, err)
+		assert.Equal(t, issued, pair, "the same pair is returned")
+	})
+
+	t.Run("replaced token after grace period", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetTokenByID", mock.Anything, userIDDefault).Return(rotatedToken(time.Now().UTC().Add(-time.Second)), nil)
+		a := App{repo: r, hasher: hasher(t), accessSecret: accessSecret, refreshGrace: time.Minute}
+
+		_, err := a.Refresh(ctx, access, b64Refresh)
+		assert.ErrorIs(t, err, ErrPermissionDenied)
+	})
+
+	t.Run("grace period is disabled", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetTokenByID", mock.Anything, userIDDefault).Return(rotatedToken(time.Now().UTC().Add(time.Minute)), nil)
+		h := mocks.NewHasher(t)
+		h.On("Compare", mock.Anything, "current-hash", refresh).Return(ErrPermissionDenied)
+		a := App{repo: r, hasher: h, accessSecret: accessSecret}
+
+		_, err := a.Refresh(ctx, access, b64Refresh)
+		assert.ErrorIs(t, err, ErrPermissionDenied)
+	})
+
+	t.Run("concurrent rotation within grace period", func(t *testing.T) {
+		old := entities.RefreshToken{UserID: userIDDefault, Hash: "old-hash", Expires: time.Now().UTC().Add(time.Minute)}
+		r := mocks.NewRepo(t)
+		r.On("GetTokenByID", mock.Anything, userIDDefault).Return(old, nil).Once()
+		r.On("Rotate", mock.Anything, "old-hash", mock.MatchedBy(func(next entities.RefreshToken) bool {
+			return next.Rotated.Hash == "old-hash" && len(next.Rotated.Pair) > 0
+		})).Return(ErrNotFound)
+		r.On("GetTokenByID", mock.Anything, userIDDefault).Return(rotatedToken(time.Now().UTC().Add(time.Minute)), nil).Once()
+		h := mocks.NewHasher(t)
+		h.On("Compare", mock.Anything, "old-hash", refresh).Return(nil)
+		h.On("Generate", mock.Anything, mock.AnythingOfType("string")).Return("new-hash", nil)
+		a := App{
+			repo:           r,
+			hasher:         h,
+			accessSecret:   accessSecret,
+			accessExpires:  time.Minute,
+			refreshExpires: time.Minute,
+			refreshGrace:   time.Minute,
+		}
+
+		pair, err := a.Refresh(ctx, access, b64Refresh)
+		require.NoError(t, err)
+		assert.Equal(t, issued, pair, "the pair of the winning refresh is returned")
+	})
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"crypto/rsa"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// JWEKey encrypts access tokens issued for the audience, so their claims are readable only
+// by it. A shared key is used with dir, an RSA key with RSA-OAEP-256. Content is always A256GCM
+type JWEKey struct {
+	Audience string
+	// Shared is the 32-byte key of the dir algorithm
+	Shared []byte
+	Public *rsa.PublicKey
+	// Private lets the service decrypt tokens encrypted with Public, e.g. to introspect them
+	Private *rsa.PrivateKey
+}
+
+func (k JWEKey) recipient() jose.Recipient {
+	if k.Shared != nil {
+		return jose.Recipient{Algorithm: jose.DIRECT, Key: k.Shared, KeyID: k.Audience}
+	}
+	return jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: k.Public, KeyID: k.Audience}
+}
+
+func (k JWEKey) decryptionKey() any {
+	if k.Shared != nil {
+		return k.Shared
+	}
+	if k.Private != nil {
+		return k.Private
+	}
+	return nil
+}
+
+// jweKeys are the keys by audience
+type jweKeys map[string]JWEKey
+
+// WithJWE wraps signed access tokens issued for the audiences of the keys into JWE.
+// The audience is taken from CtxAudience and is required, so a client cannot get
+// a plain JWS by naming no audience
+func WithJWE(keys ...JWEKey) Option {
+	return func(a *App) {
+		a.jwe = make(jweKeys, len(keys))
+		for _, k := range keys {
+			a.jwe[k.Audience] = k
+		}
+	}
+}
+
+// WithAudiences allows the audiences of access tokens which are not encrypted
+func WithAudiences(audiences ...string) Option {
+	return func(a *App) {
+		a.audiences = make(map[string]bool, len(audiences))
+		for _, aud := range audiences {
+			a.audiences[aud] = true
+		}
+	}
+}
+
+// checkAudience accepts only the configured audiences, since the client names it itself.
+// No audience is accepted unless tokens are encrypted
+func (a App) checkAudience(aud string) error {
+	if _, ok := a.jwe[aud]; ok || a.audiences[aud] {
+		return nil
+	}
+	if aud == "" && len(a.jwe) == 0 {
+		return nil
+	}
+	return ErrInvalidAudience
+}
+
+// encrypt nests the signed token into JWE for the audience. The audience is the key ID,
+// so the verifier can choose the key without trying all of them
+func (k jweKeys) encrypt(aud string, signed string) (string, error) {
+	key, ok := k[aud]
+	if !ok {
+		// the audience is allowed by WithAudiences
+		return signed, nil
+	}
+	opts := (&jose.EncrypterOptions{}).WithContentType("JWT")
+	enc, err := jose.NewEncrypter(jose.A256GCM, key.recipient(), opts)
+	if err != nil {
+		return "", err
+	}
+	obj, err := enc.Encrypt([]byte(signed))
+	if err != nil {
+		return "", err
+	}
+	return obj.CompactSerialize()
+}
+
+// decrypt returns the signed token nested into the JWE one
+func (k jweKeys) decrypt(token string) (string, error) {
+	obj, err := jose.ParseEncrypted(token,
+		[]jose.KeyAlgorithm{jose.DIRECT, jose.RSA_OAEP_256},
+		[]jose.ContentEncryption{jose.A256GCM},
+	)
+	if err != nil {
+		return "", ErrIncorrectToken
+	}
+	key := k[obj.Header.KeyID].decryptionKey()
+	if key == nil {
+		return "", ErrIncorrectToken
+	}
+	signed, err := obj.Decrypt(key)
+	if err != nil {
+		return "", ErrIncorrectToken
+	}
+	return string(signed), nil
+}
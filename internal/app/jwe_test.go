@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app/mocks"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApp_GeneratePair_jwe(t *testing.T) {
+	shared := make([]byte, 32)
+	_, err := rand.Read(shared)
+	require.NoError(t, err)
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		key  JWEKey
+	}{
+		{
+			name: "dir",
+			key:  JWEKey{Audience: "api", Shared: shared},
+		},
+		{
+			name: "RSA-OAEP-256",
+			key:  JWEKey{Audience: "api", Public: &priv.PublicKey, Private: priv},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(repoCreateOrUpdate(t), hasherGenerate(t), string(accessSecret), time.Minute, time.Minute,
+				WithJWE(tt.key))
+
+			pair, err := a.GeneratePair(context.WithValue(ctx, CtxAudience, "api"), userIDDefault)
+			require.NoError(t, err)
+			segments := strings.Split(pair.Access, ".")
+			require.Len(t, segments, 5, "compact JWE")
+			header, err := base64.RawURLEncoding.DecodeString(segments[0])
+			require.NoError(t, err)
+			assert.Contains(t, string(header), `"kid":"api"`)
+			assert.NotContains(t, pair.Access, base64.RawURLEncoding.EncodeToString([]byte(userIDDefault)))
+
+			claims, err := decodeToken(accessSecret, a.jwe, pair.Access)
+			require.NoError(t, err)
+			assert.Equal(t, userIDDefault, claims["sub"])
+			assert.Equal(t, "api", claims["aud"])
+
+			_, err = decodeToken(accessSecret, nil, pair.Access)
+			assert.ErrorIs(t, err, ErrIncorrectToken, "not readable without the key")
+		})
+	}
+
+	t.Run("audience without key", func(t *testing.T) {
+		a := New(nil, mocks.NewHasher(t), string(accessSecret), time.Minute, time.Minute,
+			WithJWE(JWEKey{Audience: "api", Shared: shared}))
+
+		_, err := a.GeneratePair(context.WithValue(ctx, CtxAudience, "web"), userIDDefault)
+		assert.ErrorIs(t, err, ErrInvalidAudience, "unknown audience")
+		_, err = a.GeneratePair(ctx, userIDDefault)
+		assert.ErrorIs(t, err, ErrInvalidAudience, "no audience would leave the token plain")
+	})
+
+	t.Run("allowed plain audience", func(t *testing.T) {
+		a := New(repoCreateOrUpdate(t), hasherGenerate(t), string(accessSecret), time.Minute, time.Minute,
+			WithJWE(JWEKey{Audience: "api", Shared: shared}), WithAudiences("web"))
+
+		pair, err := a.GeneratePair(context.WithValue(ctx, CtxAudience, "web"), userIDDefault)
+		require.NoError(t, err)
+		assert.Equal(t, 2, strings.Count(pair.Access, "."), "plain JWS")
+	})
+
+	t.Run("audience without configuration", func(t *testing.T) {
+		a := New(nil, mocks.NewHasher(t), string(accessSecret), time.Minute, time.Minute)
+
+		_, err := a.GeneratePair(context.WithValue(ctx, CtxAudience, "api"), userIDDefault)
+		assert.ErrorIs(t, err, ErrInvalidAudience)
+	})
+
+	t.Run("public key only", func(t *testing.T) {
+		keys := jweKeys{"api": {Audience: "api", Public: &priv.PublicKey}}
+		token, err := keys.encrypt("api", generateAccess(userIDDefault, time.Now().Add(time.Minute)))
+		require.NoError(t, err)
+		_, err = decodeToken(accessSecret, keys, token)
+		assert.ErrorIs(t, err, ErrIncorrectToken, "the audience reads it, not the service")
+	})
+}
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"jwt-auth/internal/entities"
+	"jwt-auth/internal/logger"
+	"log/slog"
+	"net"
+	"time"
+)
+
+//go:generate go run github.com/vektra/mockery/v2@v2.32.4 --name=AttemptStore
+type AttemptStore interface {
+	// GetAttempts returns zero Attempts when there were no failures within the store window
+	GetAttempts(ctx context.Context, key string) (entities.Attempts, error)
+	// AddFailure atomically increments the counter. The counter starts from scratch
+	// when the previous failure is older than the store window
+	AddFailure(ctx context.Context, key string, now time.Time) (entities.Attempts, error)
+	ResetAttempts(ctx context.Context, key string) error
+}
+
+type LockoutPolicy struct {
+	// FreeAttempts is the number of failures allowed without any delay
+	FreeAttempts int
+	// BaseDelay is the delay after the first failure above FreeAttempts. It is doubled
+	// on every next failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Threshold is the number of failures after which the account is locked for LockDuration.
+	// Client IPs are never locked, they are only slowed down
+	Threshold    int
+	LockDuration time.Duration
+}
+
+func (p LockoutPolicy) delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+func (p LockoutPolicy) check(at entities.Attempts, now time.Time, account bool) error {
+	if account && p.Threshold > 0 && at.Failures >= p.Threshold {
+		if now.Before(at.Last.Add(p.LockDuration)) {
+			return ErrAccountLocked
+		}
+		return nil
+	}
+	if now.Before(at.Last.Add(p.delay(at.Failures))) {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+func WithLockout(store AttemptStore, policy LockoutPolicy) Option {
+	return func(a *App) {
+		a.attempts = store
+		a.lockout = policy
+	}
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func userKey(userID string) string {
+	return "user:" + userID
+}
+
+func emailKey(email string) string {
+	return "email:" + email
+}
+
+// checkAttempts returns ErrTooManyAttempts or ErrAccountLocked if the client IP
+// or the account identified by the key is not allowed to try again yet
+func (a App) checkAttempts(ctx context.Context, key string) error {
+	if a.attempts == nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	if ip := clientIP(ctx); ip != "" {
+		at, err := a.attempts.GetAttempts(ctx, ipKey(ip))
+		if err != nil {
+			return err
+		}
+		if err := a.lockout.check(at, now, false); err != nil {
+			return err
+		}
+	}
+	at, err := a.attempts.GetAttempts(ctx, key)
+	if err != nil {
+		return err
+	}
+	return a.lockout.check(at, now, true)
+}
+
+// recordAttempt updates counters of the client IP and the account after checking
+// credentials. Only ErrPermissionDenied counts as a failure
+func (a App) recordAttempt(ctx context.Context, key string, result error) error {
+	const fn = "app.recordAttempt"
+
+	if a.attempts == nil {
+		return result
+	}
+	log := logger.Log(ctx).With(slog.String("fn", fn), slog.String("key", key))
+	if result == nil {
+		return a.attempts.ResetAttempts(ctx, key)
+	}
+	if !errors.Is(result, ErrPermissionDenied) {
+		return result
+	}
+
+	now := time.Now().UTC()
+	if ip := clientIP(ctx); ip != "" {
+		if _, err := a.attempts.AddFailure(ctx, ipKey(ip), now); err != nil {
+			return err
+		}
+	}
+	at, err := a.attempts.AddFailure(ctx, key, now)
+	if err != nil {
+		return err
+	}
+	log.Debug("failed attempt", slog.Int("failures", at.Failures))
+	return result
+}
+
+// Unlock resets failure counters of the user, including login attempts by email
+func (a App) Unlock(ctx context.Context, userID string) error {
+	if a.attempts == nil {
+		return ErrUnsupported
+	}
+	if !isValidUUID(userID) {
+		return ErrInvalidUserID
+	}
+	if err := a.attempts.ResetAttempts(ctx, userKey(userID)); err != nil {
+		return err
+	}
+	if a.users == nil {
+		return nil
+	}
+	user, err := a.users.GetUserByID(ctx, userID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return a.attempts.ResetAttempts(ctx, emailKey(user.Email))
+}
+
+func (a App) UnlockIP(ctx context.Context, ip string) error {
+	if a.attempts == nil {
+		return ErrUnsupported
+	}
+	if net.ParseIP(ip) == nil {
+		return ErrInvalidIP
+	}
+	return a.attempts.ResetAttempts(ctx, ipKey(ip))
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app/mocks"
+	"jwt-auth/internal/entities"
+	"testing"
+	"time"
+)
+
+var testPolicy = LockoutPolicy{
+	FreeAttempts: 2,
+	BaseDelay:    time.Second,
+	MaxDelay:     10 * time.Second,
+	Threshold:    8,
+	LockDuration: time.Hour,
+}
+
+func TestLockoutPolicy_delay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Second},
+		{failures: 4, want: 2 * time.Second},
+		{failures: 6, want: 8 * time.Second},
+		{failures: 7, want: 10 * time.Second},
+		{failures: 100, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		assert.Equalf(t, tt.want, testPolicy.delay(tt.failures), "delay(%d)", tt.failures)
+	}
+}
+
+func TestLockoutPolicy_check(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name     string
+		attempts entities.Attempts
+		account  bool
+		wantErr  error
+	}{
+		{
+			name:     "free attempts",
+			attempts: entities.Attempts{Failures: 2, Last: now},
+			account:  true,
+		},
+		{
+			name:     "backoff",
+			attempts: entities.Attempts{Failures: 3, Last: now.Add(-time.Second / 2)},
+			account:  true,
+			wantErr:  ErrTooManyAttempts,
+		},
+		{
+			name:     "backoff passed",
+			attempts: entities.Attempts{Failures: 3, Last: now.Add(-2 * time.Second)},
+			account:  true,
+		},
+		{
+			name:     "locked account",
+			attempts: entities.Attempts{Failures: 8, Last: now.Add(-time.Minute)},
+			account:  true,
+			wantErr:  ErrAccountLocked,
+		},
+		{
+			name:     "lock expired",
+			attempts: entities.Attempts{Failures: 8, Last: now.Add(-2 * time.Hour)},
+			account:  true,
+		},
+		{
+			name:     "client IP is not locked",
+			attempts: entities.Attempts{Failures: 8, Last: now.Add(-time.Minute)},
+			account:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testPolicy.check(tt.attempts, now, tt.account)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApp_Refresh_lockout(t *testing.T) {
+	access := generateAccess(userIDDefault, time.Now().UTC().Add(time.Minute))
+	refresh := base64.StdEncoding.EncodeToString([]byte(randomToken()))
+	//nolint:all
+	ipCtx := context.WithValue(ctx, CtxClientIP, "192.0.2.1")
+
+	t.Run("failure is counted for the user and the IP", func(t *testing.T) {
+		store := mocks.NewAttemptStore(t)
+		store.
+			On("GetAttempts", mock.Anything, mock.AnythingOfType("string")).
+			Return(entities.Attempts{}, nil).
+			Twice()
+		store.
+			On("AddFailure", mock.Anything, "ip:192.0.2.1", mock.AnythingOfType("time.Time")).
+			Return(entities.Attempts{Failures: 1}, nil).
+			Once()
+		store.
+			On("AddFailure", mock.Anything, "user:"+userIDDefault, mock.AnythingOfType("time.Time")).
+			Return(entities.Attempts{Failures: 1}, nil).
+			Once()
+
+		a := App{
+			repo:         repoGetTokenByID(t, "hash", time.Now().UTC().Add(time.Minute)),
+			hasher:       hasherCompare(t),
+			accessSecret: accessSecret,
+			attempts:     store,
+			lockout:      testPolicy,
+		}
+		_, err := a.Refresh(ipCtx, access, refresh)
+		require.ErrorIs(t, err, ErrPermissionDenied)
+	})
+
+	t.Run("locked user is rejected before comparing", func(t *testing.T) {
+		store := mocks.NewAttemptStore(t)
+		store.
+			On("GetAttempts", mock.Anything, "ip:192.0.2.1").
+			Return(entities.Attempts{}, nil).
+			Once()
+		store.
+			On("GetAttempts", mock.Anything, "user:"+userIDDefault).
+			Return(entities.Attempts{Failures: 8, Last: time.Now().UTC()}, nil).
+			Once()
+
+		a := App{
+			accessSecret: accessSecret,
+			attempts:     store,
+			lockout:      testPolicy,
+		}
+		_, err := a.Refresh(ipCtx, access, refresh)
+		require.ErrorIs(t, err, ErrAccountLocked)
+	})
+
+	t.Run("slowed down IP is rejected", func(t *testing.T) {
+		store := mocks.NewAttemptStore(t)
+		store.
+			On("GetAttempts", mock.Anything, "ip:192.0.2.1").
+			Return(entities.Attempts{Failures: 5, Last: time.Now().UTC()}, nil).
+			Once()
+
+		a := App{
+			accessSecret: accessSecret,
+			attempts:     store,
+			lockout:      testPolicy,
+		}
+		_, err := a.Refresh(ipCtx, access, refresh)
+		require.ErrorIs(t, err, ErrTooManyAttempts)
+	})
+}
@@ -28,6 +28,20 @@ func (_m *Repo) CreateOrUpdate(ctx context.Context, token entities.RefreshToken)
 	return r0
 }
 
+// DeleteTokenByID provides a mock function with given fields: ctx, userID
+func (_m *Repo) DeleteTokenByID(ctx context.Context, userID string) error {
+	ret := _m.Called(ctx, userID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetTokenByID provides a mock function with given fields: ctx, userID
 func (_m *Repo) GetTokenByID(ctx context.Context, userID string) (entities.RefreshToken, error) {
 	ret := _m.Called(ctx, userID)
@@ -52,6 +66,44 @@ func (_m *Repo) GetTokenByID(ctx context.Context, userID string) (entities.Refre
 	return r0, r1
 }
 
+// GetTokenBySelector provides a mock function with given fields: ctx, selector
+func (_m *Repo) GetTokenBySelector(ctx context.Context, selector string) (entities.RefreshToken, error) {
+	ret := _m.Called(ctx, selector)
+
+	var r0 entities.RefreshToken
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (entities.RefreshToken, error)); ok {
+		return rf(ctx, selector)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) entities.RefreshToken); ok {
+		r0 = rf(ctx, selector)
+	} else {
+		r0 = ret.Get(0).(entities.RefreshToken)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, selector)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Rotate provides a mock function with given fields: ctx, prevHash, token
+func (_m *Repo) Rotate(ctx context.Context, prevHash string, token entities.RefreshToken) error {
+	ret := _m.Called(ctx, prevHash, token)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, entities.RefreshToken) error); ok {
+		r0 = rf(ctx, prevHash, token)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewRepo creates a new instance of Repo. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewRepo(t interface {
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"jwt-auth/internal/entities"
+	"slices"
+	"strings"
+	"time"
+)
+
+// OpaqueAllClients selects every client, including ones without a client ID
+const OpaqueAllClients = "*"
+
+// WithOpaqueAccess issues opaque access tokens instead of JWTs to the listed clients,
+// identified by CtxClientID. Opaque tokens are stored hashed with the refresh session,
+// checked by Introspect and stop being active as soon as the session is rotated or revoked.
+// Their refresh tokens always have a selector, as there is no JWT to find the session by
+func WithOpaqueAccess(clients ...string) Option {
+	return func(a *App) {
+		a.opaqueClients = clients
+	}
+}
+
+func (a App) opaqueAccess(ctx context.Context) bool {
+	if slices.Contains(a.opaqueClients, OpaqueAllClients) {
+		return true
+	}
+	id, _ := ctx.Value(CtxClientID).(string)
+	return id != "" && slices.Contains(a.opaqueClients, id)
+}
+
+// newOpaqueAccess returns the selector.secret access token and the hash of the secret.
+// The secret is random, so a fast hash is enough and keeps introspection cheap
+func newOpaqueAccess(selector string) (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	return selector + selectorSep + secret, hashOpaque(secret), nil
+}
+
+func hashOpaque(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Introspect reports whether the access token is active. JWTs and PASETO tokens are checked by the
+// signature and the expiration, opaque tokens by the session they are stored with. Tokens which are
+// not active are not an error
+func (a App) Introspect(ctx context.Context, access string) (entities.Introspection, error) {
+	// a JWT has three segments, or five if it is encrypted, an opaque token two
+	if n := strings.Count(access, "."); n == 2 || n == 4 || strings.HasPrefix(access, pasetoPrefix) {
+		return a.introspectSigned(access), nil
+	}
+	selector, secret, ok := strings.Cut(access, selectorSep)
+	if !ok || selector == "" {
+		return entities.Introspection{}, nil
+	}
+	session, err := a.repo.GetTokenBySelector(ctx, selector)
+	if errors.Is(err, ErrNotFound) {
+		return entities.Introspection{}, nil
+	} else if err != nil {
+		return entities.Introspection{}, err
+	}
+	now := time.Now().UTC()
+	if session.Access.Hash == "" || !now.Before(session.Access.Expires) || !now.Before(session.Expires) {
+		return entities.Introspection{}, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(session.Access.Hash), []byte(hashOpaque(secret))) != 1 {
+		return entities.Introspection{}, nil
+	}
+	return entities.Introspection{
+		Active:       true,
+		Subject:      session.UserID,
+		Expires:      session.Access.Expires,
+		Confirmation: session.Confirmation,
+	}, nil
+}
+
+// introspectSigned checks a JWT or a PASETO token
+func (a App) introspectSigned(access string) entities.Introspection {
+	claims, err := a.decodeAccess(access)
+	if err != nil {
+		return entities.Introspection{}
+	}
+	sub, _ := claims["sub"].(string)
+	aud, _ := claims["aud"].(string)
+	exp, err := claims.GetExpirationTime()
+	if sub == "" || err != nil || exp == nil {
+		return entities.Introspection{}
+	}
+	cnf, _ := claims["cnf"].(map[string]any)
+	jkt, _ := cnf["jkt"].(string)
+	x5t, _ := cnf["x5t#S256"].(string)
+	return entities.Introspection{
+		Active:       true,
+		Subject:      sub,
+		Audience:     aud,
+		Expires:      exp.UTC(),
+		Confirmation: entities.Confirmation{JKT: jkt, X5TS256: x5t},
+	}
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app/mocks"
+	"jwt-auth/internal/entities"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApp_opaqueAccess(t *testing.T) {
+	withClient := context.WithValue(ctx, CtxClientID, "mobile")
+
+	a := App{opaqueClients: []string{"mobile"}}
+	assert.True(t, a.opaqueAccess(withClient))
+	assert.False(t, a.opaqueAccess(ctx), "client without ID")
+	assert.False(t, a.opaqueAccess(context.WithValue(ctx, CtxClientID, "web")), "another client")
+
+	a = App{opaqueClients: []string{OpaqueAllClients}}
+	assert.True(t, a.opaqueAccess(ctx), "every client")
+}
+
+func TestApp_GeneratePair_opaque(t *testing.T) {
+	r := mocks.NewRepo(t)
+	var stored entities.RefreshToken
+	r.
+		On("CreateOrUpdate", mock.Anything, mock.AnythingOfType("entities.RefreshToken")).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(entities.RefreshToken) }).
+		Return(nil)
+	a := New(r, hasherGenerate(t), string(accessSecret), time.Minute, time.Minute, WithOpaqueAccess(OpaqueAllClients))
+
+	pair, err := a.GeneratePair(ctx, userIDDefault)
+	require.NoError(t, err)
+	selector, secret, ok := strings.Cut(pair.Access, selectorSep)
+	require.True(t, ok, "access token is selector.secret")
+	assert.Equal(t, stored.Selector, selector)
+	assert.Equal(t, hashOpaque(secret), stored.Access.Hash, "only the hash is stored")
+	assert.True(t, strings.HasPrefix(pair.Refresh, selector+selectorSep), "refresh token shares the selector")
+}
+
+func TestApp_Introspect(t *testing.T) {
+	now := time.Now().UTC()
+	session := func(accessExp time.Time) entities.RefreshToken {
+		return entities.RefreshToken{
+			UserID:       userIDDefault,
+			Selector:     "selector",
+			Hash:         "hash",
+			Expires:      now.Add(time.Hour),
+			Confirmation: entities.Confirmation{JKT: "thumbprint"},
+			Access:       entities.OpaqueAccess{Hash: hashOpaque("secret"), Expires: accessExp},
+		}
+	}
+	repo := func(t *testing.T, token entities.RefreshToken, err error) Repo {
+		r := mocks.NewRepo(t)
+		r.On("GetTokenBySelector", mock.Anything, mock.AnythingOfType("string")).Return(token, err)
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		repo   Repo
+		access string
+		want   entities.Introspection
+	}{
+		{
+			name:   "active opaque token",
+			repo:   repo(t, session(now.Add(time.Minute)), nil),
+			access: "selector.secret",
+			want: entities.Introspection{
+				Active:       true,
+				Subject:      userIDDefault,
+				Expires:      now.Add(time.Minute),
+				Confirmation: entities.Confirmation{JKT: "thumbprint"},
+			},
+		},
+		{
+			name:   "wrong secret",
+			repo:   repo(t, session(now.Add(time.Minute)), nil),
+			access: "selector.another-secret",
+		},
+		{
+			name:   "expired opaque token",
+			repo:   repo(t, session(now.Add(-time.Second)), nil),
+			access: "selector.secret",
+		},
+		{
+			name:   "revoked session",
+			repo:   repo(t, entities.RefreshToken{}, ErrNotFound),
+			access: "selector.secret",
+		},
+		{
+			name:   "active JWT",
+			repo:   mocks.NewRepo(t),
+			access: generateAccess(userIDDefault, now.Add(time.Minute)),
+			want: entities.Introspection{
+				Active:  true,
+				Subject: userIDDefault,
+				Expires: now.Add(time.Minute).Truncate(time.Second),
+			},
+		},
+		{
+			name:   "expired JWT",
+			repo:   mocks.NewRepo(t),
+			access: generateAccess(userIDDefault, now.Add(-time.Minute)),
+		},
+		{
+			name:   "malformed token",
+			repo:   mocks.NewRepo(t),
+			access: "token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := App{repo: tt.repo, accessSecret: accessSecret}
+			got, err := a.Introspect(ctx, tt.access)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
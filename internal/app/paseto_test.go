@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app/mocks"
+	"jwt-auth/internal/entities"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApp_GeneratePair_paseto(t *testing.T) {
+	local := make([]byte, 32)
+	_, err := rand.Read(local)
+	require.NoError(t, err)
+	_, public, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		opt    Option
+		prefix string
+	}{
+		{
+			name:   "v4.local",
+			opt:    WithPASETOLocal(local),
+			prefix: "v4.local.",
+		},
+		{
+			name:   "v4.public",
+			opt:    WithPASETOPublic(public),
+			prefix: "v4.public.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(repoCreateOrUpdate(t), hasherGenerate(t), string(accessSecret), time.Minute, time.Minute, tt.opt, WithAudiences("api"))
+
+			withCnf := context.WithValue(context.WithValue(ctx, CtxAudience, "api"), CtxDPoPJKT, "thumbprint")
+			pair, err := a.GeneratePair(withCnf, userIDDefault)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(pair.Access, tt.prefix))
+
+			sub, err := a.Subject(ctx, pair.Access)
+			require.NoError(t, err)
+			assert.Equal(t, userIDDefault, sub)
+
+			got, err := a.Introspect(ctx, pair.Access)
+			require.NoError(t, err)
+			assert.True(t, got.Active)
+			assert.Equal(t, "api", got.Audience)
+			assert.Equal(t, entities.Confirmation{JKT: "thumbprint"}, got.Confirmation)
+
+			_, err = a.Subject(ctx, generateAccess(userIDDefault, time.Now().Add(time.Minute)))
+			assert.ErrorIs(t, err, ErrIncorrectToken, "JWT is not accepted")
+		})
+	}
+}
+
+func TestPasetoFormat_parse(t *testing.T) {
+	p := pasetoFormat{local: make([]byte, 32)}
+	now := time.Now()
+
+	expired, err := p.sign(userIDDefault, "", entities.Confirmation{}, now.Add(-time.Hour), now.Add(-time.Minute))
+	require.NoError(t, err)
+	claims, err := p.parse(expired)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+	assert.Equal(t, userIDDefault, claims["sub"], "claims of expired token are returned")
+
+	valid, err := p.sign(userIDDefault, "", entities.Confirmation{}, now, now.Add(time.Minute))
+	require.NoError(t, err)
+	_, err = pasetoFormat{local: []byte(strings.Repeat("k", 32))}.parse(valid)
+	assert.ErrorIs(t, err, ErrIncorrectToken, "another key")
+	_, public, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, err = pasetoFormat{public: public}.parse(valid)
+	assert.ErrorIs(t, err, ErrIncorrectToken, "another purpose")
+}
+
+func TestApp_Refresh_paseto(t *testing.T) {
+	r := mocks.NewRepo(t)
+	refresh := randomToken()
+	r.On("GetTokenByID", mock.Anything, userIDDefault).Return(entities.RefreshToken{
+		UserID:  userIDDefault,
+		Hash:    "hash",
+		Expires: time.Now().UTC().Add(time.Minute),
+	}, nil)
+	r.On("Rotate", mock.Anything, "hash", mock.AnythingOfType("entities.RefreshToken")).Return(nil)
+	h := mocks.NewHasher(t)
+	h.On("Compare", mock.Anything, "hash", refresh).Return(nil)
+	h.On("Generate", mock.Anything, mock.AnythingOfType("string")).Return("next-hash", nil)
+	p := pasetoFormat{local: make([]byte, 32)}
+	a := App{repo: r, hasher: h, accessSecret: accessSecret, accessExpires: time.Minute, paseto: p}
+
+	now := time.Now()
+	access, err := p.sign(userIDDefault, "", entities.Confirmation{}, now.Add(-time.Hour), now.Add(-time.Minute))
+	require.NoError(t, err)
+	pair, err := a.Refresh(ctx, access, formatRefresh("", refresh))
+	require.NoError(t, err, "expired access token is accepted")
+	assert.True(t, strings.HasPrefix(pair.Access, "v4.local."))
+}
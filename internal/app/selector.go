@@ -0,0 +1,45 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+)
+
+// selectorSep separates the selector from the verifier. It is not used by both base64 alphabets
+const selectorSep = "."
+
+// WithSelectorTokens issues refresh tokens formatted as selector.verifier. The selector
+// finds the session and only the verifier is hashed, so such tokens are refreshed
+// without the access token. Tokens of the two-token mode are still accepted
+func WithSelectorTokens() Option {
+	return func(a *App) {
+		a.selectorTokens = true
+	}
+}
+
+func newSelector() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// formatRefresh encodes the verifier and prepends the selector, if any
+func formatRefresh(selector string, verifier string) string {
+	b64 := base64.StdEncoding.EncodeToString([]byte(verifier))
+	if selector == "" {
+		return b64
+	}
+	return selector + selectorSep + b64
+}
+
+// splitRefresh returns the selector and the base64 verifier of the refresh token.
+// The selector is empty for tokens of the two-token mode
+func splitRefresh(token string) (string, string) {
+	if selector, verifier, ok := strings.Cut(token, selectorSep); ok {
+		return selector, verifier
+	}
+	return "", token
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app/mocks"
+	"jwt-auth/internal/entities"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitRefresh(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString([]byte("verifier"))
+
+	selector, verifier := splitRefresh(formatRefresh("selector", "verifier"))
+	assert.Equal(t, "selector", selector)
+	assert.Equal(t, b64, verifier)
+
+	selector, verifier = splitRefresh(formatRefresh("", "verifier"))
+	assert.Empty(t, selector, "two-token mode")
+	assert.Equal(t, b64, verifier)
+}
+
+func TestApp_GeneratePair_selector(t *testing.T) {
+	r := mocks.NewRepo(t)
+	var stored entities.RefreshToken
+	r.
+		On("CreateOrUpdate", mock.Anything, mock.AnythingOfType("entities.RefreshToken")).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(entities.RefreshToken) }).
+		Return(nil)
+	a := New(r, hasherGenerate(t), string(accessSecret), time.Minute, time.Minute, WithSelectorTokens())
+
+	pair, err := a.GeneratePair(ctx, userIDDefault)
+	require.NoError(t, err)
+	selector, _, ok := strings.Cut(pair.Refresh, selectorSep)
+	require.True(t, ok, "refresh token has a selector")
+	assert.Equal(t, stored.Selector, selector)
+}
+
+func TestApp_Refresh_selector(t *testing.T) {
+	refresh := randomToken()
+	token := entities.RefreshToken{
+		UserID:   userIDDefault,
+		Selector: "selector",
+		Hash:     "hash",
+		Expires:  time.Now().UTC().Add(time.Minute),
+	}
+	hasher := func(t *testing.T) *mocks.Hasher {
+		h := mocks.NewHasher(t)
+		h.On("Compare", mock.Anything, "hash", refresh).Return(nil)
+		h.On("Generate", mock.Anything, mock.AnythingOfType("string")).Return("next-hash", nil)
+		return h
+	}
+
+	t.Run("refreshed without access token", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetTokenBySelector", mock.Anything, "selector").Return(token, nil)
+		r.
+			On("Rotate", mock.Anything, "hash", mock.MatchedBy(func(next entities.RefreshToken) bool {
+				return next.UserID == userIDDefault && next.Selector == "selector"
+			})).
+			Return(nil)
+		a := App{repo: r, hasher: hasher(t), accessSecret: accessSecret, accessExpires: time.Minute}
+
+		pair, err := a.Refresh(ctx, "", formatRefresh("selector", refresh))
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(pair.Refresh, "selector"+selectorSep), "selector is kept")
+	})
+
+	t.Run("unknown selector", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetTokenBySelector", mock.Anything, "unknown").Return(entities.RefreshToken{}, ErrNotFound)
+		a := App{repo: r, accessSecret: accessSecret}
+
+		_, err := a.Refresh(ctx, "", formatRefresh("unknown", refresh))
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("two-token session switches to selector", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		legacy := token
+		legacy.Selector = ""
+		r.On("GetTokenByID", mock.Anything, userIDDefault).Return(legacy, nil)
+		r.
+			On("Rotate", mock.Anything, "hash", mock.MatchedBy(func(next entities.RefreshToken) bool {
+				return next.Selector != ""
+			})).
+			Return(nil)
+		a := App{repo: r, hasher: hasher(t), accessSecret: accessSecret, accessExpires: time.Minute, selectorTokens: true}
+
+		access := generateAccess(userIDDefault, time.Now().UTC().Add(-time.Minute))
+		pair, err := a.Refresh(ctx, access, formatRefresh("", refresh))
+		require.NoError(t, err)
+		assert.Contains(t, pair.Refresh, selectorSep)
+	})
+
+	t.Run("two-token mode needs access token", func(t *testing.T) {
+		a := App{repo: mocks.NewRepo(t), accessSecret: accessSecret}
+
+		_, err := a.Refresh(ctx, "", formatRefresh("", refresh))
+		assert.ErrorIs(t, err, ErrIncorrectToken)
+	})
+}
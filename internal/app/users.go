@@ -0,0 +1,325 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"jwt-auth/internal/entities"
+	"jwt-auth/internal/logger"
+	"log/slog"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+//go:generate go run github.com/vektra/mockery/v2@v2.32.4 --name=Users
+type Users interface {
+	CreateUser(ctx context.Context, user entities.User) error
+	GetUserByID(ctx context.Context, userID string) (entities.User, error)
+	GetUserByEmail(ctx context.Context, email string) (entities.User, error)
+	UpdatePassword(ctx context.Context, userID string, hash string) error
+	// RehashPassword replaces the password hash only if it is still prevHash, so an upgrade
+	// of the hash does not undo a concurrent password change. Returns ErrNotFound otherwise
+	RehashPassword(ctx context.Context, userID string, prevHash string, hash string) error
+	SetVerified(ctx context.Context, userID string) error
+	CreateOneTimeToken(ctx context.Context, token entities.OneTimeToken) error
+	GetOneTimeToken(ctx context.Context, userID string, purpose entities.Purpose) (entities.OneTimeToken, error)
+	// DeleteOneTimeToken deletes the token only if the stored hash is still the same,
+	// so a token can be consumed once even by concurrent requests. Returns ErrNotFound otherwise
+	DeleteOneTimeToken(ctx context.Context, token entities.OneTimeToken) error
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.32.4 --name=Mailer
+type Mailer interface {
+	SendPasswordReset(ctx context.Context, email string, token string) error
+	SendVerification(ctx context.Context, email string, token string) error
+}
+
+// WithUsers enables registration, login, password reset and email verification
+func WithUsers(users Users, mailer Mailer) Option {
+	return func(a *App) {
+		a.users = users
+		a.mailer = mailer
+	}
+}
+
+func WithOneTimeExpires(reset time.Duration, verify time.Duration) Option {
+	return func(a *App) {
+		a.resetExpires = reset
+		a.verifyExpires = verify
+	}
+}
+
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func normalizeEmail(email string) (string, bool) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", false
+	}
+	return email, true
+}
+
+// isValidPassword also keeps the password within the bcrypt limit of 72 bytes
+func isValidPassword(password string) bool {
+	return len(password) >= 8 && len(password) <= 72
+}
+
+func (a App) issueOneTime(ctx context.Context, userID string, purpose entities.Purpose, expires time.Duration) (string, error) {
+	token := randomToken()
+	hash, err := a.tokens().Generate(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	exp := time.Now().UTC().Add(expires)
+	if err := a.users.CreateOneTimeToken(ctx, entities.NewOneTime(userID, purpose, hash, exp)); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString([]byte(token)), nil
+}
+
+func (a App) consumeOneTime(ctx context.Context, userID string, purpose entities.Purpose, b64Token string) error {
+	token, err := base64.StdEncoding.DecodeString(b64Token)
+	if err != nil {
+		return ErrIncorrectToken
+	}
+	stored, err := a.users.GetOneTimeToken(ctx, userID, purpose)
+	if errors.Is(err, ErrNotFound) {
+		return ErrPermissionDenied
+	} else if err != nil {
+		return err
+	}
+	if stored.Expires.Before(time.Now().UTC()) {
+		return ErrExpired
+	}
+	if err := a.tokens().Compare(ctx, stored.Hash, string(token)); err != nil {
+		return err
+	}
+	err = a.users.DeleteOneTimeToken(ctx, stored)
+	if errors.Is(err, ErrNotFound) {
+		return ErrPermissionDenied
+	}
+	return err
+}
+
+func (a App) sendVerification(ctx context.Context, user entities.User) error {
+	token, err := a.issueOneTime(ctx, user.ID, entities.PurposeEmailVerify, a.verifyExpires)
+	if err != nil {
+		return err
+	}
+	return a.mailer.SendVerification(ctx, user.Email, token)
+}
+
+func (a App) Register(ctx context.Context, email string, password string) (string, error) {
+	const fn = "app.Register"
+
+	if a.users == nil {
+		return "", ErrUnsupported
+	}
+	log := logger.Log(ctx).With(slog.String("fn", fn))
+
+	log.Debug("validating credentials")
+	email, ok := normalizeEmail(email)
+	if !ok {
+		return "", ErrInvalidEmail
+	}
+	if !isValidPassword(password) {
+		return "", ErrInvalidPassword
+	}
+	hash, err := a.hasher.Generate(ctx, password)
+	if err != nil {
+		return "", err
+	}
+
+	user := entities.NewUser(newUUID(), email, hash)
+	log.Debug("creating user", slog.String("userID", user.ID))
+	if err := a.users.CreateUser(ctx, user); err != nil {
+		return "", err
+	}
+
+	log.Debug("sending verification")
+	if err := a.sendVerification(ctx, user); err != nil {
+		return "", err
+	}
+	return user.ID, nil
+}
+
+func (a App) Login(ctx context.Context, email string, password string) (entities.JWTPair, error) {
+	const fn = "app.Login"
+
+	if a.users == nil {
+		return entities.JWTPair{}, ErrUnsupported
+	}
+	log := logger.Log(ctx).With(slog.String("fn", fn))
+
+	email, ok := normalizeEmail(email)
+	if !ok {
+		return entities.JWTPair{}, ErrInvalidEmail
+	}
+	// Attempts are counted by email, so a locked account looks the same whether it exists or not
+	if err := a.checkAttempts(ctx, emailKey(email)); err != nil {
+		return entities.JWTPair{}, err
+	}
+	user, err := a.users.GetUserByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		return entities.JWTPair{}, a.recordAttempt(ctx, emailKey(email), ErrPermissionDenied)
+	} else if err != nil {
+		return entities.JWTPair{}, err
+	}
+
+	log.Debug("comparing", slog.String("userID", user.ID))
+	err = a.recordAttempt(ctx, emailKey(email), a.hasher.Compare(ctx, user.PasswordHash, password))
+	if err != nil {
+		return entities.JWTPair{}, err
+	}
+	if needsRehash(a.hasher, user.PasswordHash) {
+		a.rehashPassword(ctx, user, password)
+	}
+	return a.GeneratePair(ctx, user.ID)
+}
+
+// rehashPassword upgrades the password hash to the current algorithm and parameters.
+// Failures are only logged, the old hash keeps working
+func (a App) rehashPassword(ctx context.Context, user entities.User, password string) {
+	const fn = "app.rehashPassword"
+	log := logger.Log(ctx).With(slog.String("fn", fn), slog.String("userID", user.ID))
+
+	hash, err := a.hasher.Generate(ctx, password)
+	if err == nil {
+		err = a.users.RehashPassword(ctx, user.ID, user.PasswordHash, hash)
+	}
+	if errors.Is(err, ErrNotFound) {
+		log.Debug("password has been changed concurrently")
+	} else if err != nil {
+		log.Warn("cannot upgrade password hash", slog.String("error", err.Error()))
+	}
+}
+
+// ResendVerification sends a new verification token. Unknown and already verified
+// emails are silently skipped so the endpoint cannot be used to enumerate users
+func (a App) ResendVerification(ctx context.Context, email string) error {
+	if a.users == nil {
+		return ErrUnsupported
+	}
+	email, ok := normalizeEmail(email)
+	if !ok {
+		return ErrInvalidEmail
+	}
+	user, err := a.users.GetUserByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if user.Verified {
+		return nil
+	}
+	return a.sendVerification(ctx, user)
+}
+
+func (a App) VerifyEmail(ctx context.Context, email string, token string) error {
+	const fn = "app.VerifyEmail"
+
+	if a.users == nil {
+		return ErrUnsupported
+	}
+	log := logger.Log(ctx).With(slog.String("fn", fn))
+
+	email, ok := normalizeEmail(email)
+	if !ok {
+		return ErrInvalidEmail
+	}
+	user, err := a.users.GetUserByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		return ErrPermissionDenied
+	} else if err != nil {
+		return err
+	}
+
+	log.Debug("consuming token", slog.String("userID", user.ID))
+	if err := a.consumeOneTime(ctx, user.ID, entities.PurposeEmailVerify, token); err != nil {
+		return err
+	}
+	return a.users.SetVerified(ctx, user.ID)
+}
+
+// ForgotPassword sends a password reset token. As with ResendVerification, unknown
+// emails are not reported
+func (a App) ForgotPassword(ctx context.Context, email string) error {
+	const fn = "app.ForgotPassword"
+
+	if a.users == nil {
+		return ErrUnsupported
+	}
+	log := logger.Log(ctx).With(slog.String("fn", fn))
+
+	email, ok := normalizeEmail(email)
+	if !ok {
+		return ErrInvalidEmail
+	}
+	user, err := a.users.GetUserByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		log.Debug("user not found")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	log.Debug("issuing reset token", slog.String("userID", user.ID))
+	token, err := a.issueOneTime(ctx, user.ID, entities.PurposePasswordReset, a.resetExpires)
+	if err != nil {
+		return err
+	}
+	return a.mailer.SendPasswordReset(ctx, user.Email, token)
+}
+
+// ResetPassword sets a new password and revokes the refresh session of the user,
+// so every previously issued pair stops being refreshable
+func (a App) ResetPassword(ctx context.Context, email string, token string, password string) error {
+	const fn = "app.ResetPassword"
+
+	if a.users == nil {
+		return ErrUnsupported
+	}
+	log := logger.Log(ctx).With(slog.String("fn", fn))
+
+	email, ok := normalizeEmail(email)
+	if !ok {
+		return ErrInvalidEmail
+	}
+	if !isValidPassword(password) {
+		return ErrInvalidPassword
+	}
+	user, err := a.users.GetUserByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		return ErrPermissionDenied
+	} else if err != nil {
+		return err
+	}
+
+	log.Debug("consuming token", slog.String("userID", user.ID))
+	if err := a.consumeOneTime(ctx, user.ID, entities.PurposePasswordReset, token); err != nil {
+		return err
+	}
+	hash, err := a.hasher.Generate(ctx, password)
+	if err != nil {
+		return err
+	}
+	if err := a.users.UpdatePassword(ctx, user.ID, hash); err != nil {
+		return err
+	}
+
+	log.Debug("revoking sessions", slog.String("userID", user.ID))
+	return a.repo.DeleteTokenByID(ctx, user.ID)
+}
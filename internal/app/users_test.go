@@ -0,0 +1,352 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app/mocks"
+	"jwt-auth/internal/entities"
+	"testing"
+	"time"
+)
+
+const userEmail = "user@example.com"
+
+func usersGetByEmail(t *testing.T, user entities.User) *mocks.Users {
+	u := mocks.NewUsers(t)
+	u.
+		On("GetUserByEmail", mock.Anything, mock.AnythingOfType("string")).
+		Return(func(_ context.Context, email string) (entities.User, error) {
+			if email != user.Email {
+				return entities.User{}, ErrNotFound
+			}
+			return user, nil
+		})
+	return u
+}
+
+func usersOneTime(t *testing.T, user entities.User, tok entities.OneTimeToken, deleteErr error) *mocks.Users {
+	u := usersGetByEmail(t, user)
+	u.
+		On("GetOneTimeToken", mock.Anything, user.ID, tok.Purpose).
+		Return(tok, nil)
+	u.
+		On("DeleteOneTimeToken", mock.Anything, tok).
+		Return(deleteErr).
+		Maybe()
+	return u
+}
+
+func hasherCompareOK(t *testing.T) Hasher {
+	h := mocks.NewHasher(t)
+	h.
+		On("Compare", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+		Return(nil)
+	return h
+}
+
+func TestApp_Register(t *testing.T) {
+	type fields struct {
+		users  Users
+		mailer Mailer
+		hasher Hasher
+	}
+	type args struct {
+		email    string
+		password string
+	}
+	createdUsers := func(t *testing.T, err error) Users {
+		u := mocks.NewUsers(t)
+		u.
+			On("CreateUser", mock.Anything, mock.AnythingOfType("entities.User")).
+			Return(err)
+		if err == nil {
+			u.
+				On("CreateOneTimeToken", mock.Anything, mock.AnythingOfType("entities.OneTimeToken")).
+				Return(nil)
+		}
+		return u
+	}
+	sentMailer := func(t *testing.T) Mailer {
+		m := mocks.NewMailer(t)
+		m.
+			On("SendVerification", mock.Anything, userEmail, mock.AnythingOfType("string")).
+			Return(nil)
+		return m
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name: "correct registration",
+			fields: fields{
+				users:  createdUsers(t, nil),
+				mailer: sentMailer(t),
+				hasher: hasherGenerate(t),
+			},
+			args:    args{email: " User@Example.com", password: "password"},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "duplicate email",
+			fields: fields{
+				users:  createdUsers(t, ErrAlreadyExists),
+				hasher: hasherGenerate(t),
+			},
+			args: args{email: userEmail, password: "password"},
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrAlreadyExists)
+			},
+		},
+		{
+			name:   "invalid email",
+			fields: fields{users: mocks.NewUsers(t)},
+			args:   args{email: "Name <user@example.com>", password: "password"},
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrInvalidEmail)
+			},
+		},
+		{
+			name:   "short password",
+			fields: fields{users: mocks.NewUsers(t)},
+			args:   args{email: userEmail, password: "short"},
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrInvalidPassword)
+			},
+		},
+		{
+			name:   "users are disabled",
+			fields: fields{},
+			args:   args{email: userEmail, password: "password"},
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrUnsupported)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := App{
+				users:         tt.fields.users,
+				mailer:        tt.fields.mailer,
+				hasher:        tt.fields.hasher,
+				verifyExpires: time.Minute,
+			}
+			got, err := a.Register(ctx, tt.args.email, tt.args.password)
+			if !tt.wantErr(t, err, fmt.Sprintf("Register(%v, %v)", tt.args.email, tt.args.password)) || err != nil {
+				return
+			}
+			assert.True(t, isValidUUID(got))
+		})
+	}
+}
+
+// rehasher reports every hash as outdated
+type rehasher struct {
+	*mocks.Hasher
+}
+
+func (rehasher) NeedsRehash(string) bool {
+	return true
+}
+
+func usersRehash(t *testing.T, user entities.User, rehashErr error) *mocks.Users {
+	u := usersGetByEmail(t, user)
+	u.
+		On("RehashPassword", mock.Anything, user.ID, user.PasswordHash, "password-hash").
+		Return(rehashErr).
+		Once()
+	return u
+}
+
+func TestApp_Login(t *testing.T) {
+	user := entities.NewUser(userIDDefault, userEmail, "password-hash")
+	tests := []struct {
+		name     string
+		users    Users
+		hasher   Hasher
+		repo     Repo
+		email    string
+		password string
+		wantErr  assert.ErrorAssertionFunc
+	}{
+		{
+			name:     "correct login",
+			users:    usersGetByEmail(t, user),
+			hasher:   hasherCompareGenerate(t),
+			repo:     repoCreateOrUpdate(t),
+			email:    userEmail,
+			password: "password",
+			wantErr:  assert.NoError,
+		},
+		{
+			name:     "outdated hash is upgraded",
+			users:    usersRehash(t, user, nil),
+			hasher:   rehasher{hasherCompareGenerate(t).(*mocks.Hasher)},
+			repo:     repoCreateOrUpdate(t),
+			email:    userEmail,
+			password: "password",
+			wantErr:  assert.NoError,
+		},
+		{
+			name:     "failed upgrade does not break login",
+			users:    usersRehash(t, user, ErrNotFound),
+			hasher:   rehasher{hasherCompareGenerate(t).(*mocks.Hasher)},
+			repo:     repoCreateOrUpdate(t),
+			email:    userEmail,
+			password: "password",
+			wantErr:  assert.NoError,
+		},
+		{
+			name:     "wrong password",
+			users:    usersGetByEmail(t, user),
+			hasher:   hasherCompare(t),
+			email:    userEmail,
+			password: "password",
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrPermissionDenied)
+			},
+		},
+		{
+			name:     "unknown email is not reported",
+			users:    usersGetByEmail(t, user),
+			email:    "other@example.com",
+			password: "password",
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrPermissionDenied)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := App{
+				users:          tt.users,
+				hasher:         tt.hasher,
+				repo:           tt.repo,
+				accessSecret:   accessSecret,
+				accessExpires:  time.Minute,
+				refreshExpires: time.Minute,
+			}
+			got, err := a.Login(ctx, tt.email, tt.password)
+			if !tt.wantErr(t, err, fmt.Sprintf("Login(%v, %v)", tt.email, tt.password)) || err != nil {
+				return
+			}
+			claims, err := decodeToken(accessSecret, nil, got.Access)
+			require.NoError(t, err)
+			assert.Equal(t, userIDDefault, claims["sub"])
+		})
+	}
+}
+
+func TestApp_ForgotPassword(t *testing.T) {
+	user := entities.NewUser(userIDDefault, userEmail, "password-hash")
+
+	u := usersGetByEmail(t, user)
+	u.
+		On("CreateOneTimeToken", mock.Anything, mock.MatchedBy(func(tok entities.OneTimeToken) bool {
+			return tok.UserID == userIDDefault && tok.Purpose == entities.PurposePasswordReset
+		})).
+		Return(nil).
+		Once()
+	m := mocks.NewMailer(t)
+	m.
+		On("SendPasswordReset", mock.Anything, userEmail, mock.AnythingOfType("string")).
+		Return(nil).
+		Once()
+
+	a := App{users: u, mailer: m, hasher: hasherGenerate(t), resetExpires: time.Minute}
+	require.NoError(t, a.ForgotPassword(ctx, userEmail))
+	require.NoError(t, a.ForgotPassword(ctx, "other@example.com"), "unknown email is not reported")
+}
+
+func TestApp_ResetPassword(t *testing.T) {
+	user := entities.NewUser(userIDDefault, userEmail, "password-hash")
+	token := base64.StdEncoding.EncodeToString([]byte("reset-token"))
+	valid := entities.NewOneTime(userIDDefault, entities.PurposePasswordReset, "reset-token-hash", time.Now().Add(time.Minute))
+	expired := entities.NewOneTime(userIDDefault, entities.PurposePasswordReset, "reset-token-hash", time.Now().Add(-time.Minute))
+
+	revokingRepo := func(t *testing.T) Repo {
+		r := mocks.NewRepo(t)
+		r.
+			On("DeleteTokenByID", mock.Anything, userIDDefault).
+			Return(nil).
+			Once()
+		return r
+	}
+	updatingUsers := func(t *testing.T) Users {
+		u := usersOneTime(t, user, valid, nil)
+		u.
+			On("UpdatePassword", mock.Anything, userIDDefault, "new-password-hash").
+			Return(nil).
+			Once()
+		return u
+	}
+
+	tests := []struct {
+		name    string
+		users   Users
+		hasher  Hasher
+		repo    Repo
+		token   string
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:    "correct reset revokes sessions",
+			users:   updatingUsers(t),
+			hasher:  hasherCompareGenerate(t),
+			repo:    revokingRepo(t),
+			token:   token,
+			wantErr: assert.NoError,
+		},
+		{
+			name:   "wrong token",
+			users:  usersOneTime(t, user, valid, nil),
+			hasher: hasherCompare(t),
+			token:  token,
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrPermissionDenied)
+			},
+		},
+		{
+			name:  "expired token",
+			users: usersOneTime(t, user, expired, nil),
+			token: token,
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrExpired)
+			},
+		},
+		{
+			name:   "token has already been used",
+			users:  usersOneTime(t, user, valid, ErrNotFound),
+			hasher: hasherCompareOK(t),
+			token:  token,
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrPermissionDenied)
+			},
+		},
+		{
+			name:  "not base64 token",
+			users: usersGetByEmail(t, user),
+			token: "не-токен",
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrIncorrectToken)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := App{
+				users:  tt.users,
+				hasher: tt.hasher,
+				repo:   tt.repo,
+			}
+			err := a.ResetPassword(ctx, userEmail, tt.token, "new-password")
+			tt.wantErr(t, err, fmt.Sprintf("ResetPassword(%v)", tt.token))
+		})
+	}
+}
@@ -12,15 +12,119 @@ const (
 	EnvRelease = gin.ReleaseMode
 )
 
+const (
+	StoreMemory = "memory"
+	StoreMongo  = "mongo"
+)
+
+const (
+	HasherBCrypt = "bcrypt"
+	HasherArgon2 = "argon2"
+	HasherHMAC   = "hmac"
+)
+
+const (
+	AccessJWT          = "jwt"
+	AccessPASETOLocal  = "v4.local"
+	AccessPASETOPublic = "v4.public"
+)
+
+const (
+	RefreshPair     = "pair"
+	RefreshSelector = "selector"
+)
+
+const (
+	ResponseLegacy = "legacy"
+	// ResponseProblem is the RFC 7807 format of errors
+	ResponseProblem = "problem"
+)
+
+const (
+	DriverMongo    = "mongo"
+	DriverPostgres = "postgres"
+	DriverBolt     = "bolt"
+	DriverMemory   = "memory"
+	DriverRedis    = "redis"
+)
+
 type Config struct {
-	Env            string `env:"ENV" env-default:"release"`
-	MongoConn      string `env:"MONGO_CONN" env-required:"true"`
-	MongoDB        string `env:"MONGO_DB" env-required:"true"`
-	HTTPAddr       string `env:"HTTP_ADDR" env-default:":8888"`
-	BCryptCost     int    `env:"BCRYPT_COST" env-default:"10"`
-	AccessSecret   string `env:"ACCESS_SECRET_KEY" env-required:"true"`
-	AccessExpires  int    `env:"ACCESS_EXPIRES" env-default:"300"`
-	RefreshExpires int    `env:"REFRESH_EXPIRES" env-default:"2592000"` // default - 30 days
+	Env              string   `env:"ENV" env-default:"release"`
+	StorageDriver    string   `env:"STORAGE_DRIVER" env-default:"mongo"` // mongo, postgres, bolt, memory or redis
+	MongoConn        string   `env:"MONGO_CONN"`                         // required by the mongo driver and mongo stores
+	MongoDB          string   `env:"MONGO_DB"`
+	PostgresConn     string   `env:"POSTGRES_CONN"`                             // required by the postgres driver
+	PostgresSweep    int      `env:"POSTGRES_SWEEP_INTERVAL" env-default:"300"` // expired tokens removal period
+	BoltPath         string   `env:"BOLT_PATH" env-default:"jwt-auth.db"`
+	BoltSweep        int      `env:"BOLT_SWEEP_INTERVAL" env-default:"60"` // expired tokens removal period
+	MemorySnapshot   string   `env:"MEMORY_SNAPSHOT_PATH"`                 // snapshots are disabled when empty
+	MemorySnapInt    int      `env:"MEMORY_SNAPSHOT_INTERVAL" env-default:"60"`
+	RedisAddr        string   `env:"REDIS_ADDR" env-default:"localhost:6379"`
+	RedisPassword    string   `env:"REDIS_PASSWORD"`
+	RedisDB          int      `env:"REDIS_DB" env-default:"0"`
+	HTTPAddr         string   `env:"HTTP_ADDR" env-default:":8888"`
+	TLSCert          string   `env:"TLS_CERT_FILE"` // HTTPS is enabled when set
+	TLSKey           string   `env:"TLS_KEY_FILE"`
+	TLSClientCA      string   `env:"TLS_CLIENT_CA_FILE"` // mutual TLS is enabled when set
+	TLSRequireCert   bool     `env:"TLS_REQUIRE_CLIENT_CERT" env-default:"false"`
+	TLSClients       []string `env:"TLS_ALLOWED_CLIENTS" env-separator:","`
+	PublicURL        string   `env:"PUBLIC_URL"`                             // external base URL, e.g. https://auth.example.com
+	DPoPStore        string   `env:"DPOP_REPLAY_STORE" env-default:"memory"` // memory or mongo
+	Hasher           string   `env:"HASHER" env-default:"bcrypt"`            // bcrypt or argon2
+	BCryptCost       int      `env:"BCRYPT_COST" env-default:"10"`
+	Argon2Memory     int      `env:"ARGON2_MEMORY" env-default:"65536"` // KiB
+	Argon2Time       int      `env:"ARGON2_TIME" env-default:"3"`
+	Argon2Threads    int      `env:"ARGON2_PARALLELISM" env-default:"4"`
+	TokenHasher      string   `env:"TOKEN_HASHER"` // refresh and one-time tokens, HASHER when empty
+	HMACPepper       string   `env:"HMAC_PEPPER"`  // at least 32 bytes
+	AccessSecret     string   `env:"ACCESS_SECRET_KEY" env-required:"true"`
+	AccessExpires    int      `env:"ACCESS_EXPIRES" env-default:"300"`
+	AccessFormat     string   `env:"ACCESS_TOKEN_FORMAT" env-default:"jwt"` // jwt, v4.local or v4.public
+	PASETOKey        string   `env:"PASETO_KEY"`                            // 32 bytes in base64, the Ed25519 seed for v4.public
+	RefreshExpires   int      `env:"REFRESH_EXPIRES" env-default:"2592000"` // default - 30 days
+	RefreshGrace     int      `env:"REFRESH_GRACE" env-default:"0"`         // disabled when zero
+	RefreshTokens    string   `env:"REFRESH_TOKENS" env-default:"pair"`     // pair or selector
+	ErrorResponse    string   `env:"ERROR_RESPONSE" env-default:"legacy"`   // legacy or problem
+	V1Deprecated     string   `env:"API_V1_DEPRECATED"`                     // RFC 3339, the v2 release by default
+	V1Sunset         string   `env:"API_V1_SUNSET"`                         // RFC 3339 date of /api/v1 removal
+	RefreshCookie    bool     `env:"REFRESH_COOKIE" env-default:"false"`    // refresh token in HttpOnly cookie
+	CookieSameSite   string   `env:"REFRESH_COOKIE_SAMESITE" env-default:"strict"`
+	CookieDomain     string   `env:"REFRESH_COOKIE_DOMAIN"`
+	CORSOrigins      []string `env:"CORS_ORIGINS" env-separator:","` // CORS is disabled when empty
+	CORSMethods      []string `env:"CORS_METHODS" env-separator:","`
+	CORSHeaders      []string `env:"CORS_HEADERS" env-separator:","`
+	CORSCredentials  bool     `env:"CORS_CREDENTIALS" env-default:"false"`
+	CORSMaxAge       int      `env:"CORS_MAX_AGE" env-default:"600"`
+	ResetExpires     int      `env:"RESET_EXPIRES" env-default:"3600"`
+	VerifyExpires    int      `env:"VERIFY_EXPIRES" env-default:"86400"`
+	SMTPAddr         string   `env:"SMTP_ADDR"` // tokens are written to the log in debug when empty
+	SMTPFrom         string   `env:"SMTP_FROM"`
+	SMTPUser         string   `env:"SMTP_USER"`
+	SMTPPassword     string   `env:"SMTP_PASSWORD"`
+	AdminToken       string   `env:"ADMIN_TOKEN"`      // admin routes are disabled when empty
+	IntrospectToken  string   `env:"INTROSPECT_TOKEN"` // introspection is disabled when empty
+	TrustedProxies   []string `env:"TRUSTED_PROXIES" env-separator:","`
+	OpaqueClients    []string `env:"OPAQUE_ACCESS_CLIENTS" env-separator:","`
+	LockoutStore     string   `env:"LOCKOUT_STORE"` // memory or mongo, disabled when empty
+	LockoutFree      int      `env:"LOCKOUT_FREE_ATTEMPTS" env-default:"3"`
+	LockoutDelay     int      `env:"LOCKOUT_BASE_DELAY" env-default:"1"`
+	LockoutMaxDelay  int      `env:"LOCKOUT_MAX_DELAY" env-default:"300"`
+	LockoutThreshold int      `env:"LOCKOUT_THRESHOLD" env-default:"10"`
+	LockoutDuration  int      `env:"LOCKOUT_DURATION" env-default:"900"`
+	LockoutWindow    int      `env:"LOCKOUT_WINDOW" env-default:"86400"`
+	RateLimitStore   string   `env:"RATE_LIMIT_STORE"` // memory or mongo, disabled when empty
+	// Rules are in the "<burst>/<period>" format. Routes are mapped by the full path, e.g. "/api/generate:10/1m"
+	RateLimitIP           string            `env:"RATE_LIMIT_IP" env-default:"60/1m"`
+	RateLimitClient       string            `env:"RATE_LIMIT_CLIENT" env-default:"120/1m"`
+	RateLimitRoutesIP     map[string]string `env:"RATE_LIMIT_ROUTES_IP"`
+	RateLimitRoutesClient map[string]string `env:"RATE_LIMIT_ROUTES_CLIENT"`
+	// Access token encryption keys by audience: "dir:<base64 of 32 bytes>" or "rsa:<PEM file>".
+	// A public RSA key only encrypts tokens, a private one also lets the service read them,
+	// which refreshing pairs needs unless REFRESH_TOKENS=selector. Audiences cannot have ":" or ","
+	JWEKeys map[string]string `env:"JWE_KEYS"`
+	// Audiences of access tokens which are not encrypted. Clients may ask only for these
+	// and the ones of JWE_KEYS, which make the audience required
+	AccessAudiences []string `env:"ACCESS_AUDIENCES" env-separator:","`
 }
 
 func MustLoad() Config {
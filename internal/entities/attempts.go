@@ -0,0 +1,11 @@
+package entities
+
+import "time"
+
+// Attempts counts consecutive failed authentication attempts for a key such as
+// a user or a client IP
+type Attempts struct {
+	Key      string
+	Failures int
+	Last     time.Time
+}
@@ -0,0 +1,13 @@
+package entities
+
+import "time"
+
+// Introspection is the state of an access token (RFC 7662). Other fields are set only
+// for active tokens
+type Introspection struct {
+	Active       bool
+	Subject      string
+	Audience     string
+	Expires      time.Time
+	Confirmation Confirmation
+}
@@ -1,13 +1,25 @@
 package entities
 
+import "time"
+
+const (
+	TokenTypeBearer = "Bearer"
+	// TokenTypeDPoP is the type of access tokens bound to a DPoP key (RFC 9449)
+	TokenTypeDPoP = "DPoP"
+)
+
 type JWTPair struct {
-	Access  string
-	Refresh string
+	Access         string
+	Refresh        string
+	TokenType      string
+	AccessExpires  time.Time
+	RefreshExpires time.Time
 }
 
 func NewPair(access string, refresh string) JWTPair {
 	return JWTPair{
-		Access:  access,
-		Refresh: refresh,
+		Access:    access,
+		Refresh:   refresh,
+		TokenType: TokenTypeBearer,
 	}
 }
@@ -0,0 +1,28 @@
+package entities
+
+import "time"
+
+type Purpose string
+
+const (
+	PurposePasswordReset Purpose = "password_reset"
+	PurposeEmailVerify   Purpose = "email_verify"
+)
+
+// OneTimeToken is a single-use token sent to the user by email. Only one token per
+// user and purpose is active: issuing a new one replaces the previous
+type OneTimeToken struct {
+	UserID  string
+	Purpose Purpose
+	Hash    string
+	Expires time.Time
+}
+
+func NewOneTime(userID string, purpose Purpose, hash string, exp time.Time) OneTimeToken {
+	return OneTimeToken{
+		UserID:  userID,
+		Purpose: purpose,
+		Hash:    hash,
+		Expires: exp,
+	}
+}
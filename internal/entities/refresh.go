@@ -2,12 +2,42 @@ package entities
 
 import "time"
 
-type RefreshToken struct {
-	UserID  string
+// Confirmation binds tokens to a proof-of-possession key, mirroring the cnf claim (RFC 7800)
+type Confirmation struct {
+	// JKT is the JWK SHA-256 thumbprint of the DPoP key
+	JKT string
+	// X5TS256 is the SHA-256 thumbprint of the mutual-TLS client certificate (RFC 8705)
+	X5TS256 string
+}
+
+// Rotated is the refresh token replaced by the last rotation. Until Expires the replaced
+// token gets the pair issued by that rotation again instead of being rejected
+type Rotated struct {
+	Hash string
+	// Pair is the issued pair encrypted with a key derived from the replaced token
+	Pair    []byte
+	Expires time.Time
+}
+
+// OpaqueAccess is the opaque access token issued with the session instead of a JWT.
+// Hash is empty when the access token is a JWT
+type OpaqueAccess struct {
 	Hash    string
 	Expires time.Time
 }
 
+type RefreshToken struct {
+	UserID string
+	// Selector is the public part of a selector.verifier refresh token which indexes the
+	// session, so it can be refreshed without the access token. Empty in the two-token mode
+	Selector     string
+	Hash         string
+	Expires      time.Time
+	Confirmation Confirmation
+	Rotated      Rotated
+	Access       OpaqueAccess
+}
+
 func NewRefresh(userID string, hash string, exp time.Time) RefreshToken {
 	return RefreshToken{
 		UserID:  userID,
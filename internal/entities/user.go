@@ -0,0 +1,16 @@
+package entities
+
+type User struct {
+	ID           string
+	Email        string
+	PasswordHash string
+	Verified     bool
+}
+
+func NewUser(id string, email string, passwordHash string) User {
+	return User{
+		ID:           id,
+		Email:        email,
+		PasswordHash: passwordHash,
+	}
+}
@@ -0,0 +1,107 @@
+package httpserver
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"jwt-auth/internal/entities"
+	"net/http"
+	"path"
+	"time"
+)
+
+var ErrCSRF = errors.New("CSRF token does not match")
+
+const (
+	csrfCookie = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// RefreshCookie makes issued refresh tokens set in a Secure HttpOnly cookie instead of
+// the response body, so browser scripts never see them. The cookie is sent only to the
+// refresh route of the API version the pair was issued by
+type RefreshCookie struct {
+	// Name of the cookie, refresh_token by default
+	Name string
+	// SameSite is http.SameSiteStrictMode by default
+	SameSite http.SameSite
+	Domain   string
+	// Lifetime of refresh tokens. It is the cookie max age for pairs without the expiry,
+	// which the grace period may return if they were stored by older versions
+	Lifetime time.Duration
+}
+
+// WithRefreshCookie enables the refresh cookie. Refresh requests without the token in the
+// body use the cookie and must pass the value of the csrf_token cookie in the X-CSRF-Token
+// header (double submit)
+func WithRefreshCookie(cookie RefreshCookie) Option {
+	return func(o *options) {
+		if cookie.Name == "" {
+			cookie.Name = "refresh_token"
+		}
+		if cookie.SameSite == 0 {
+			cookie.SameSite = http.SameSiteStrictMode
+		}
+		o.refreshCookie = &cookie
+	}
+}
+
+// setCookies wraps the pair response, moving the refresh token to the cookie and
+// issuing a new CSRF token with it
+func (rc *RefreshCookie) setCookies(next func(c *gin.Context, pair entities.JWTPair)) func(c *gin.Context, pair entities.JWTPair) {
+	return func(c *gin.Context, pair entities.JWTPair) {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			handleError(c, err)
+			return
+		}
+		maxAge := int(rc.Lifetime.Seconds())
+		if !pair.RefreshExpires.IsZero() {
+			maxAge = int(time.Until(pair.RefreshExpires).Seconds())
+		}
+		// the pair is issued by a sibling of the refresh route, e.g. /api/v2/login
+		refreshPath := path.Join(path.Dir(c.FullPath()), "refresh")
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     rc.Name,
+			Value:    pair.Refresh,
+			Path:     refreshPath,
+			Domain:   rc.Domain,
+			MaxAge:   maxAge,
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: rc.SameSite,
+		})
+		// scripts of any page read the CSRF token to send it back in the header
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     csrfCookie,
+			Value:    base64.RawURLEncoding.EncodeToString(b),
+			Path:     "/",
+			Domain:   rc.Domain,
+			MaxAge:   maxAge,
+			Secure:   true,
+			SameSite: rc.SameSite,
+		})
+		pair.Refresh = ""
+		next(c, pair)
+	}
+}
+
+// refreshToken returns the refresh token of the cookie, if the request has it. The CSRF
+// header must match the CSRF cookie
+func (rc *RefreshCookie) refreshToken(c *gin.Context) (string, error) {
+	if rc == nil {
+		return "", nil
+	}
+	// the cookies are read as is, gin.Context.Cookie would unescape "+" of the token
+	refresh, err := c.Request.Cookie(rc.Name)
+	if err != nil || refresh.Value == "" {
+		return "", nil
+	}
+	csrf, err := c.Request.Cookie(csrfCookie)
+	if err != nil || csrf.Value == "" || subtle.ConstantTimeCompare([]byte(csrf.Value), []byte(c.GetHeader(csrfHeader))) != 1 {
+		return "", ErrCSRF
+	}
+	return refresh.Value, nil
+}
@@ -0,0 +1,150 @@
+package httpserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app"
+	"jwt-auth/internal/entities"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRefreshCookie(t *testing.T) {
+	srv := newTestServer(t, WithRefreshCookie(RefreshCookie{}))
+
+	// generate returns the access token and the cookies set
+	generate := func(t *testing.T, path string) (string, map[string]*http.Cookie) {
+		rec := do(srv, http.MethodPost, path, `{"user_id":"`+testUserID+`"}`)
+		resp := decode[TokenResponse](t, rec, http.StatusOK)
+		assert.NotEmpty(t, resp.AccessToken)
+		assert.Empty(t, resp.RefreshToken, "the refresh token is only in the cookie")
+		cookies := make(map[string]*http.Cookie)
+		for _, cookie := range rec.Result().Cookies() {
+			cookies[cookie.Name] = cookie
+		}
+		return resp.AccessToken, cookies
+	}
+
+	t.Run("cookies", func(t *testing.T) {
+		_, cookies := generate(t, "/api/v2/generate")
+		refresh := cookies["refresh_token"]
+		require.NotNil(t, refresh)
+		assert.NotEmpty(t, refresh.Value)
+		assert.Equal(t, "/api/v2/refresh", refresh.Path)
+		assert.True(t, refresh.HttpOnly)
+		assert.True(t, refresh.Secure)
+		assert.Equal(t, http.SameSiteStrictMode, refresh.SameSite)
+		assert.InDelta(t, time.Hour.Seconds(), refresh.MaxAge, 1)
+		csrf := cookies[csrfCookie]
+		require.NotNil(t, csrf)
+		assert.NotEmpty(t, csrf.Value)
+		assert.False(t, csrf.HttpOnly)
+	})
+
+	t.Run("v1 path", func(t *testing.T) {
+		rec := do(srv, http.MethodPost, "/api/generate", `{"user_id":"`+testUserID+`"}`)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		for _, cookie := range rec.Result().Cookies() {
+			if cookie.Name == "refresh_token" {
+				assert.Equal(t, "/api/refresh", cookie.Path)
+			}
+		}
+	})
+
+	tests := []struct {
+		name   string
+		csrf   func(cookie string) string
+		status int
+	}{
+		{name: "matching header", csrf: func(cookie string) string { return cookie }, status: http.StatusOK},
+		{name: "no header", csrf: func(string) string { return "" }, status: http.StatusForbidden},
+		{name: "another header", csrf: func(string) string { return "token" }, status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			access, cookies := generate(t, "/api/v2/generate")
+			body := `{"access_token":"` + access + `"}`
+			jar := "refresh_token=" + cookies["refresh_token"].Value + "; " + csrfCookie + "=" + cookies[csrfCookie].Value
+			rec := do(srv, http.MethodPut, "/api/v2/refresh", body, "Cookie", jar, csrfHeader, tt.csrf(cookies[csrfCookie].Value))
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+			if tt.status == http.StatusForbidden {
+				assert.Contains(t, rec.Body.String(), `"code":"csrf_mismatch"`)
+			}
+		})
+	}
+
+	t.Run("no token", func(t *testing.T) {
+		rec := do(srv, http.MethodPut, "/api/v2/refresh", `{}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"field":"refresh_token"`)
+	})
+}
+
+func TestRefreshCookie_grace(t *testing.T) {
+	srv := newAppServer(t, newTestApp(app.WithRefreshGrace(time.Minute), app.WithSelectorTokens()),
+		WithRefreshCookie(RefreshCookie{Lifetime: time.Hour}))
+	cookies := func(rec *httptest.ResponseRecorder) map[string]*http.Cookie {
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		m := make(map[string]*http.Cookie)
+		for _, cookie := range rec.Result().Cookies() {
+			m[cookie.Name] = cookie
+		}
+		return m
+	}
+	refresh := func(jar map[string]*http.Cookie) map[string]*http.Cookie {
+		header := "refresh_token=" + jar["refresh_token"].Value + "; " + csrfCookie + "=" + jar[csrfCookie].Value
+		return cookies(do(srv, http.MethodPut, "/api/v2/refresh", `{}`, "Cookie", header, csrfHeader, jar[csrfCookie].Value))
+	}
+
+	gen := cookies(do(srv, http.MethodPost, "/api/v2/generate", `{"user_id":"`+testUserID+`"}`))
+	ref := refresh(gen)
+	again := refresh(gen)
+	assert.Equal(t, ref["refresh_token"].Value, again["refresh_token"].Value, "the pair of the grace period")
+	assert.InDelta(t, time.Hour.Seconds(), again["refresh_token"].MaxAge, 1, "the cookie is kept")
+}
+
+func TestRefreshCookie_setCookies(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie RefreshCookie
+		pair   entities.JWTPair
+		maxAge int
+	}{
+		{
+			name:   "pair expiry",
+			cookie: RefreshCookie{Lifetime: time.Hour},
+			pair:   entities.JWTPair{Refresh: "refresh", RefreshExpires: time.Now().Add(time.Minute)},
+			maxAge: 60,
+		},
+		{
+			// pairs sealed for the grace period by older versions have no expiry
+			name:   "no pair expiry",
+			cookie: RefreshCookie{Lifetime: time.Hour},
+			pair:   entities.JWTPair{Refresh: "refresh"},
+			maxAge: 3600,
+		},
+		{
+			name:   "session cookie",
+			pair:   entities.JWTPair{Refresh: "refresh"},
+			maxAge: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			var got entities.JWTPair
+			tt.cookie.Name = "refresh_token"
+			tt.cookie.setCookies(func(c *gin.Context, pair entities.JWTPair) { got = pair })(c, tt.pair)
+			assert.Empty(t, got.Refresh, "the token is only in the cookie")
+			cookies := rec.Result().Cookies()
+			require.NotEmpty(t, cookies)
+			assert.Equal(t, "refresh", cookies[0].Value)
+			assert.InDelta(t, tt.maxAge, cookies[0].MaxAge, 1)
+			assert.GreaterOrEqual(t, cookies[0].MaxAge, 0, "the cookie is not deleted")
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package httpserver
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrCORSCredentials = errors.New(`CORS origin "*" cannot be combined with credentials`)
+
+// CORS is the policy of cross-origin requests from browsers
+type CORS struct {
+	// Origins are allowed origins, e.g. https://app.example.com. "*" allows any origin and
+	// https://*.example.com allows subdomains of example.com on HTTPS. "*" is not allowed
+	// with Credentials, any site could then make requests with the cookies of the user
+	Origins []string
+	// Methods and Headers allowed in preflight responses. Methods default to the ones
+	// of the API and Headers default to the ones the API reads
+	Methods []string
+	Headers []string
+	// Credentials allows cookies and the Authorization header
+	Credentials bool
+	// MaxAge is how long browsers cache preflight responses, not set when zero
+	MaxAge time.Duration
+}
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+	defaultCORSHeaders = []string{"Accept", "Authorization", "Content-Type", "DPoP", csrfHeader, "X-Request-ID"}
+	// corsExposed are the response headers of the API scripts may read
+	corsExposed = strings.Join([]string{"X-Request-ID", "Deprecation", "Sunset", "Retry-After"}, ", ")
+)
+
+// WithCORS enables the CORS policy on /api routes. New fails with ErrCORSCredentials
+// if the policy allows any origin with credentials
+func WithCORS(cors CORS) Option {
+	return func(o *options) {
+		if len(cors.Methods) == 0 {
+			cors.Methods = defaultCORSMethods
+		}
+		if len(cors.Headers) == 0 {
+			cors.Headers = defaultCORSHeaders
+		}
+		o.cors = &cors
+	}
+}
+
+// allowed tells whether the origin matches the policy
+func (p *CORS) allowed(origin string) bool {
+	for _, allowed := range p.Origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		// https://*.example.com matches https://app.example.com but not https://example.com
+		scheme, domain, ok := strings.Cut(allowed, "*.")
+		if ok && len(origin) > len(allowed)-1 &&
+			strings.HasPrefix(strings.ToLower(origin), strings.ToLower(scheme)) &&
+			strings.HasSuffix(strings.ToLower(origin), "."+strings.ToLower(domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyOrigin tells whether the policy allows any origin
+func (p *CORS) anyOrigin() bool {
+	for _, allowed := range p.Origins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CORS) validate() error {
+	if p.Credentials && p.anyOrigin() {
+		return ErrCORSCredentials
+	}
+	return nil
+}
+
+// middleware sets the CORS headers of allowed origins and answers preflight requests.
+// Requests of other origins are served without the headers, so browsers block them
+func (p *CORS) middleware() gin.HandlerFunc {
+	methods := strings.Join(p.Methods, ", ")
+	headers := strings.Join(p.Headers, ", ")
+	maxAge := strconv.Itoa(int(p.MaxAge.Seconds()))
+	anyOrigin := p.anyOrigin()
+	return func(c *gin.Context) {
+		// the response depends on the origin even if it is not allowed, so caches
+		// must not serve it to other origins
+		c.Writer.Header().Add("Vary", "Origin")
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if origin == "" || !p.allowed(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			c.Next()
+			return
+		}
+		if anyOrigin {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if p.Credentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			c.Header("Access-Control-Expose-Headers", corsExposed)
+			c.Next()
+			return
+		}
+		c.Header("Access-Control-Allow-Methods", methods)
+		c.Header("Access-Control-Allow-Headers", headers)
+		if p.MaxAge > 0 {
+			c.Header("Access-Control-Max-Age", maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// preflightRoutes adds OPTIONS routes to the paths of the group, so preflight requests
+// reach the CORS middleware. The middleware answers them itself
+func preflightRoutes(r *gin.Engine, group *gin.RouterGroup) {
+	base := basePath(group)
+	seen := make(map[string]bool)
+	for _, rt := range r.Routes() {
+		if rt.Method == http.MethodOptions {
+			seen[rt.Path] = true
+		}
+	}
+	for _, rt := range r.Routes() {
+		path, ok := strings.CutPrefix(rt.Path, base)
+		if !ok || seen[rt.Path] {
+			continue
+		}
+		seen[rt.Path] = true
+		group.OPTIONS(path, func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+	}
+}
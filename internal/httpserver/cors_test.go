@@ -0,0 +1,94 @@
+package httpserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS_allowed(t *testing.T) {
+	p := CORS{Origins: []string{"https://app.example.com", "https://*.example.org"}}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{origin: "https://app.example.com", want: true},
+		{origin: "https://APP.example.com", want: true},
+		{origin: "http://app.example.com", want: false},
+		{origin: "https://other.example.com", want: false},
+		{origin: "https://app.example.org", want: true},
+		{origin: "https://a.b.example.org", want: true},
+		{origin: "https://example.org", want: false},
+		{origin: "https://.example.org", want: false},
+		{origin: "https://evilexample.org", want: false},
+		{origin: "http://app.example.org", want: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, p.allowed(tt.origin), tt.origin)
+	}
+	assert.True(t, (&CORS{Origins: []string{"*"}}).allowed("http://localhost:3000"))
+}
+
+func TestCORS(t *testing.T) {
+	const origin = "https://app.example.com"
+	newServer := func(cors CORS) *Server {
+		return newTestServer(t, WithCORS(cors), WithAdminToken("admin"))
+	}
+	call := func(srv *Server, method string, path string, origin string, preflight bool) *httptest.ResponseRecorder {
+		headers := []string{"Origin", origin}
+		if preflight {
+			headers = append(headers, "Access-Control-Request-Method", http.MethodPost)
+		}
+		return do(srv, method, path, `{"user_id":"`+testUserID+`"}`, headers...)
+	}
+	srv := newServer(CORS{Origins: []string{origin}, Credentials: true, MaxAge: 10 * time.Minute})
+
+	t.Run("preflight", func(t *testing.T) {
+		for _, path := range []string{"/api/generate", "/api/v2/refresh", "/api/ping", "/api/admin/lockouts/users/1"} {
+			rec := call(srv, http.MethodOptions, path, origin, true)
+			assert.Equal(t, http.StatusNoContent, rec.Code, path)
+			assert.Equal(t, origin, rec.Header().Get("Access-Control-Allow-Origin"), path)
+			assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"), path)
+			assert.Equal(t, "GET, POST, PUT, DELETE", rec.Header().Get("Access-Control-Allow-Methods"), path)
+			assert.Contains(t, rec.Header().Get("Access-Control-Allow-Headers"), "Authorization", path)
+			assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"), path)
+		}
+	})
+
+	t.Run("request", func(t *testing.T) {
+		rec := call(srv, http.MethodPost, "/api/generate", origin, false)
+		assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, origin, rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, rec.Header().Values("Vary"), "Origin")
+		assert.Contains(t, rec.Header().Values("Vary"), "Accept")
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "X-Request-ID, Deprecation, Sunset, Retry-After", rec.Header().Get("Access-Control-Expose-Headers"))
+	})
+
+	t.Run("another origin", func(t *testing.T) {
+		rec := call(srv, http.MethodOptions, "/api/generate", "https://evil.example.com", true)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+		rec = call(srv, http.MethodPost, "/api/generate", "https://evil.example.com", false)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, rec.Header().Values("Vary"), "Origin", "cached responses are not shared")
+		rec = call(srv, http.MethodPost, "/api/generate", "", false)
+		assert.Contains(t, rec.Header().Values("Vary"), "Origin", "no origin")
+	})
+
+	t.Run("any origin", func(t *testing.T) {
+		rec := call(newServer(CORS{Origins: []string{"*"}}), http.MethodPost, "/api/generate", origin, false)
+		assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Credentials"))
+	})
+
+	t.Run("any origin with credentials", func(t *testing.T) {
+		_, err := New(slog.Default(), "", gin.ReleaseMode, newTestApp(),
+			WithCORS(CORS{Origins: []string{"https://app.example.com", "*"}, Credentials: true}))
+		assert.ErrorIs(t, err, ErrCORSCredentials)
+	})
+}
@@ -3,15 +3,57 @@ package httpserver
 import (
 	"github.com/gin-gonic/gin"
 	"jwt-auth/internal/entities"
+	"time"
 )
 
+// RefreshRequest needs the access token only for refresh tokens without a selector.
+// The refresh token may be omitted if it is in the cookie
 type RefreshRequest struct {
-	Access  string `json:"access" binding:"required"`
-	Refresh string `json:"refresh" binding:"required"`
+	Access   string `json:"access"`
+	Refresh  string `json:"refresh"`
+	Audience string `json:"audience"`
+}
+
+// RefreshTokenRequest is RefreshRequest of v2
+type RefreshTokenRequest struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Audience     string `json:"audience"`
 }
 
 type GenerateRequest struct {
-	UserID string `json:"user_id" binding:"required"`
+	UserID   string `json:"user_id" binding:"required"`
+	Audience string `json:"audience"`
+}
+
+type RegisterRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Audience string `json:"audience"`
+}
+
+type EmailRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type VerifyEmailRequest struct {
+	Email string `json:"email" binding:"required"`
+	Token string `json:"token" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type RegisterResponse struct {
+	UserID string `json:"user_id"`
 }
 
 type JWTPairResponse struct {
@@ -19,6 +61,71 @@ type JWTPairResponse struct {
 	Refresh string `json:"refresh" binding:"required"`
 }
 
+// TokenResponse follows the OAuth 2.0 access token response (RFC 6749, section 5.1).
+// Scopes are not issued yet, so scope is always omitted
+type TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in,omitempty"`
+	RefreshToken     string `json:"refresh_token,omitempty"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in,omitempty"`
+	Scope            string `json:"scope,omitempty"`
+}
+
+// ProblemResponse is an error in the RFC 7807 format. Code is stable, the other
+// fields are for humans
+type ProblemResponse struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail"`
+	Instance  string       `json:"instance"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a failed validation rule of the request field, e.g. "required"
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+}
+
+// IntrospectionResponse follows RFC 7662. Inactive tokens get only "active": false
+type IntrospectionResponse struct {
+	Active       bool              `json:"active"`
+	Subject      string            `json:"sub,omitempty"`
+	Audience     string            `json:"aud,omitempty"`
+	Expires      int64             `json:"exp,omitempty"`
+	TokenType    string            `json:"token_type,omitempty"`
+	Confirmation map[string]string `json:"cnf,omitempty"`
+}
+
+func introspectionToResponse(res entities.Introspection) IntrospectionResponse {
+	if !res.Active {
+		return IntrospectionResponse{}
+	}
+	resp := IntrospectionResponse{
+		Active:    true,
+		Subject:   res.Subject,
+		Audience:  res.Audience,
+		Expires:   res.Expires.Unix(),
+		TokenType: "Bearer",
+	}
+	cnf := make(map[string]string)
+	if res.Confirmation.JKT != "" {
+		cnf["jkt"] = res.Confirmation.JKT
+		resp.TokenType = "DPoP"
+	}
+	if res.Confirmation.X5TS256 != "" {
+		cnf["x5t#S256"] = res.Confirmation.X5TS256
+	}
+	if len(cnf) > 0 {
+		resp.Confirmation = cnf
+	}
+	return resp
+}
+
 func jwtPairToResponse(pair entities.JWTPair) JWTPairResponse {
 	return JWTPairResponse{
 		Refresh: pair.Refresh,
@@ -26,6 +133,21 @@ func jwtPairToResponse(pair entities.JWTPair) JWTPairResponse {
 	}
 }
 
+func tokenToResponse(pair entities.JWTPair, now time.Time) TokenResponse {
+	resp := TokenResponse{
+		AccessToken:  pair.Access,
+		TokenType:    pair.TokenType,
+		RefreshToken: pair.Refresh,
+	}
+	if !pair.AccessExpires.IsZero() {
+		resp.ExpiresIn = int64(pair.AccessExpires.Sub(now).Seconds())
+	}
+	if !pair.RefreshExpires.IsZero() {
+		resp.RefreshExpiresIn = int64(pair.RefreshExpires.Sub(now).Seconds())
+	}
+	return resp
+}
+
 func errorResponse(err error) gin.H {
 	return gin.H{
 		"data":  nil,
@@ -33,6 +155,13 @@ func errorResponse(err error) gin.H {
 	}
 }
 
+func successResponse(data any) gin.H {
+	return gin.H{
+		"data":  data,
+		"error": nil,
+	}
+}
+
 func jwtSuccessResponse(pair entities.JWTPair) gin.H {
 	return gin.H{
 		"data":  jwtPairToResponse(pair),
@@ -3,34 +3,125 @@ package httpserver
 import (
 	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 	"jwt-auth/internal/app"
 	"jwt-auth/internal/logger"
 	"log/slog"
 	"net/http"
+	"reflect"
+	"strings"
 )
 
 var (
 	ErrInternal     = errors.New("internal server error")
 	ErrEmptyRefresh = errors.New("refresh token is required")
+	ErrBadRequest   = errors.New("invalid request body")
+	ErrUnauthorized = errors.New("unauthorized")
 )
 
-func hideError(err error) (int, error) {
-	if errors.Is(err, app.ErrNotFound) {
-		return http.StatusNotFound, err
+const problemContentType = "application/problem+json"
+
+// apiError is the status and the code of an error in responses. Codes are a part of
+// the API contract, clients match them instead of messages, so they must not change
+type apiError struct {
+	err    error
+	status int
+	code   string
+}
+
+var apiErrors = []apiError{
+	{app.ErrNotFound, http.StatusNotFound, "not_found"},
+	{app.ErrPermissionDenied, http.StatusForbidden, "permission_denied"},
+	{app.ErrExpired, http.StatusForbidden, "expired"},
+	{app.ErrInvalidUserID, http.StatusBadRequest, "invalid_user_id"},
+	{app.ErrIncorrectToken, http.StatusBadRequest, "incorrect_token"},
+	{app.ErrInvalidEmail, http.StatusBadRequest, "invalid_email"},
+	{app.ErrInvalidPassword, http.StatusBadRequest, "invalid_password"},
+	{app.ErrInvalidIP, http.StatusBadRequest, "invalid_ip"},
+	{app.ErrInvalidProof, http.StatusBadRequest, "invalid_dpop_proof"},
+	{app.ErrInvalidAudience, http.StatusBadRequest, "invalid_audience"},
+	{app.ErrAlreadyExists, http.StatusConflict, "already_exists"},
+	{app.ErrTooManyAttempts, http.StatusTooManyRequests, "too_many_attempts"},
+	{app.ErrAccountLocked, http.StatusLocked, "account_locked"},
+	{app.ErrUnsupported, http.StatusNotImplemented, "unsupported"},
+	{ErrBadRequest, http.StatusBadRequest, "invalid_request"},
+	{ErrEmptyRefresh, http.StatusBadRequest, "invalid_request"},
+	{ErrUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{ErrUnknownClient, http.StatusForbidden, "unknown_client"},
+	{ErrRateLimited, http.StatusTooManyRequests, "rate_limited"},
+	{ErrCSRF, http.StatusForbidden, "csrf_mismatch"},
+}
+
+var errInternal = apiError{ErrInternal, http.StatusInternalServerError, "internal"}
+
+// hideError maps the error to its response. Unknown errors are internal and their
+// messages are not shown
+func hideError(err error) apiError {
+	for _, e := range apiErrors {
+		if errors.Is(err, e.err) {
+			return e
+		}
+	}
+	return errInternal
+}
+
+// handleError writes the error and aborts the request
+func handleError(c *gin.Context, err error) {
+	writeError(c, err, nil)
+}
+
+// handleBindError writes the error of binding the request body into req. Failed
+// validation rules are reported per field by the names of the JSON fields
+func handleBindError(c *gin.Context, req any, err error, public error) {
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		writeError(c, public, nil)
+		return
 	}
-	if errors.Is(err, app.ErrPermissionDenied) || errors.Is(err, app.ErrExpired) {
-		return http.StatusForbidden, err
+	fields := make([]FieldError, 0, len(invalid))
+	t := reflect.TypeOf(req)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
 	}
-	if errors.Is(err, app.ErrInvalidUserID) || errors.Is(err, app.ErrIncorrectToken) {
-		return http.StatusBadRequest, err
+	for _, fe := range invalid {
+		name := fe.Field()
+		if f, ok := t.FieldByName(fe.StructField()); ok {
+			if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, FieldError{Field: name, Rule: fe.Tag()})
 	}
-	return http.StatusInternalServerError, ErrInternal
+	writeError(c, public, fields)
 }
 
-func handleError(c *gin.Context, err error) {
-	code, hidden := hideError(err)
-	if errors.Is(hidden, ErrInternal) {
-		logger.Log(c).Error("internal server error", slog.String("error", err.Error()))
+func writeError(c *gin.Context, err error, fields []FieldError) {
+	res := hideError(err)
+	if res.err == ErrInternal {
+		logger.Log(c).Error("internal server error",
+			slog.String("error", err.Error()),
+			slog.String("request_id", c.GetString(ctxRequestID)),
+		)
+	}
+	if !c.GetBool(ctxProblemDetails) {
+		c.AbortWithStatusJSON(res.status, errorResponse(res.err))
+		return
 	}
-	c.JSON(code, errorResponse(hidden))
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(res.status, ProblemResponse{
+		Type:      "urn:jwt-auth:error:" + res.code,
+		Title:     http.StatusText(res.status),
+		Status:    res.status,
+		Detail:    res.err.Error(),
+		Instance:  c.Request.URL.Path,
+		Code:      res.code,
+		RequestID: c.GetString(ctxRequestID),
+		Errors:    fields,
+	})
+}
+
+// problemDetails makes the errors of the routes follow RFC 7807
+func problemDetails(c *gin.Context) {
+	c.Set(ctxProblemDetails, true)
+	c.Next()
 }
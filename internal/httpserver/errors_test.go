@@ -0,0 +1,118 @@
+package httpserver
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"jwt-auth/internal/app"
+	"net/http"
+	"testing"
+)
+
+func TestHideError(t *testing.T) {
+	assert.Equal(t, "invalid_user_id", hideError(app.ErrInvalidUserID).code)
+	assert.Equal(t, http.StatusLocked, hideError(app.ErrAccountLocked).status)
+
+	res := hideError(errors.New("fn=repo.Get err='connection refused'"))
+	assert.Equal(t, http.StatusInternalServerError, res.status)
+	assert.Equal(t, ErrInternal, res.err, "message is hidden")
+}
+
+func TestErrorResponses(t *testing.T) {
+	t.Run("legacy", func(t *testing.T) {
+		rec := do(newTestServer(t), http.MethodPost, "/api/generate", `{}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"data":null,"error":"invalid request body"}`, rec.Body.String())
+		assert.NotEmpty(t, rec.Header().Get("X-Request-ID"), "generated")
+	})
+
+	srv := newTestServer(t, WithProblemDetails(), WithAdminToken("admin"))
+	t.Run("v1 with problem details", func(t *testing.T) {
+		rec := do(srv, http.MethodPost, "/api/v1/generate", `{}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"data":null,"error":"invalid request body"}`, rec.Body.String(), "v1 is frozen")
+	})
+
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		requestID string
+		want      ProblemResponse
+	}{
+		{
+			name:      "validation",
+			path:      "/api/v2/generate",
+			body:      `{"audience":"api"}`,
+			requestID: "req-1",
+			want: ProblemResponse{
+				Type:      "urn:jwt-auth:error:invalid_request",
+				Title:     "Bad Request",
+				Status:    http.StatusBadRequest,
+				Detail:    "invalid request body",
+				Instance:  "/api/v2/generate",
+				Code:      "invalid_request",
+				RequestID: "req-1",
+				Errors:    []FieldError{{Field: "user_id", Rule: "required"}},
+			},
+		},
+		{
+			name:      "unknown audience",
+			path:      "/api/v2/generate",
+			body:      `{"user_id":"` + testUserID + `","audience":"api"}`,
+			requestID: "req-4",
+			want: ProblemResponse{
+				Type:      "urn:jwt-auth:error:invalid_audience",
+				Title:     "Bad Request",
+				Status:    http.StatusBadRequest,
+				Detail:    app.ErrInvalidAudience.Error(),
+				Instance:  "/api/v2/generate",
+				Code:      "invalid_audience",
+				RequestID: "req-4",
+			},
+		},
+		{
+			name:      "malformed body",
+			path:      "/api/v2/generate",
+			body:      `{`,
+			requestID: "req-2",
+			want: ProblemResponse{
+				Type:      "urn:jwt-auth:error:invalid_request",
+				Title:     "Bad Request",
+				Status:    http.StatusBadRequest,
+				Detail:    "invalid request body",
+				Instance:  "/api/v2/generate",
+				Code:      "invalid_request",
+				RequestID: "req-2",
+			},
+		},
+		{
+			name:      "app error",
+			path:      "/api/v2/generate",
+			body:      `{"user_id":"123"}`,
+			requestID: "req-3",
+			want: ProblemResponse{
+				Type:      "urn:jwt-auth:error:invalid_user_id",
+				Title:     "Bad Request",
+				Status:    http.StatusBadRequest,
+				Detail:    app.ErrInvalidUserID.Error(),
+				Instance:  "/api/v2/generate",
+				Code:      "invalid_user_id",
+				RequestID: "req-3",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(srv, http.MethodPost, tt.path, tt.body, "X-Request-ID", tt.requestID)
+			assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+			assert.Equal(t, tt.requestID, rec.Header().Get("X-Request-ID"))
+			assert.Equal(t, tt.want, decode[ProblemResponse](t, rec, tt.want.Status))
+		})
+	}
+
+	t.Run("route without a version", func(t *testing.T) {
+		rec := do(srv, http.MethodDelete, "/api/admin/lockouts/users/1", "")
+		assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+		assert.Equal(t, "unauthorized", decode[ProblemResponse](t, rec, http.StatusUnauthorized).Code)
+	})
+}
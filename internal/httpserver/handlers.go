@@ -1,39 +1,302 @@
 package httpserver
 
 import (
+	"crypto/subtle"
 	"github.com/gin-gonic/gin"
 	"jwt-auth/internal/app"
+	"jwt-auth/internal/entities"
 	"net/http"
+	"strings"
+	"time"
 )
 
-func generatePair(a app.App) gin.HandlerFunc {
+func generatePair(a app.App, res responses) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req GenerateRequest
-		if err := c.BindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(ErrEmptyRefresh))
+		if err := c.ShouldBindJSON(&req); err != nil {
+			handleBindError(c, &req, err, ErrBadRequest)
 			return
 		}
+		c.Set(app.CtxAudience, req.Audience)
 		pair, err := a.GeneratePair(c, req.UserID)
 		if err != nil {
 			handleError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, jwtSuccessResponse(pair))
+		res.pair(c, pair)
 	}
 }
 
-func refreshPair(a app.App) gin.HandlerFunc {
+func refreshPair(a app.App, res responses, cookie *RefreshCookie) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req RefreshRequest
-		if err := c.BindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(ErrEmptyRefresh))
+		if err := c.ShouldBindJSON(&req); err != nil {
+			handleBindError(c, &req, err, ErrEmptyRefresh)
 			return
 		}
-		pair, err := a.Refresh(c, req.Access, req.Refresh)
+		refresh, ok := requestRefresh(c, cookie, req.Refresh, "refresh")
+		if !ok {
+			return
+		}
+		c.Set(app.CtxAudience, req.Audience)
+		pair, err := a.Refresh(c, req.Access, refresh)
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+		res.pair(c, pair)
+	}
+}
+
+// refreshToken is refreshPair of v2, which names the fields as OAuth 2.0 does
+func refreshToken(a app.App, res responses, cookie *RefreshCookie) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RefreshTokenRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			handleBindError(c, &req, err, ErrEmptyRefresh)
+			return
+		}
+		refresh, ok := requestRefresh(c, cookie, req.RefreshToken, "refresh_token")
+		if !ok {
+			return
+		}
+		c.Set(app.CtxAudience, req.Audience)
+		pair, err := a.Refresh(c, req.AccessToken, refresh)
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+		res.pair(c, pair)
+	}
+}
+
+// requestRefresh returns the refresh token of the body or else of the cookie. The error
+// is written if there is none
+func requestRefresh(c *gin.Context, cookie *RefreshCookie, body string, field string) (string, bool) {
+	if body != "" {
+		return body, true
+	}
+	refresh, err := cookie.refreshToken(c)
+	if err != nil {
+		handleError(c, err)
+		return "", false
+	}
+	if refresh == "" {
+		writeError(c, ErrEmptyRefresh, []FieldError{{Field: field, Rule: "required"}})
+		return "", false
+	}
+	return refresh, true
+}
+
+// introspect reports the state of the access token passed as the "token" form field.
+// The response is not wrapped, as RFC 7662 clients expect the plain object
+func introspect(a app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.PostForm("token")
+		if token == "" {
+			handleError(c, ErrBadRequest)
+			return
+		}
+		res, err := a.Introspect(c, token)
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, introspectionToResponse(res))
+	}
+}
+
+func register(a app.App, res responses) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RegisterRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			handleBindError(c, &req, err, ErrBadRequest)
+			return
+		}
+		userID, err := a.Register(c, req.Email, req.Password)
 		if err != nil {
 			handleError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, jwtSuccessResponse(pair))
+		res.data(c, http.StatusCreated, RegisterResponse{UserID: userID})
+	}
+}
+
+func login(a app.App, res responses) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			handleBindError(c, &req, err, ErrBadRequest)
+			return
+		}
+		c.Set(app.CtxAudience, req.Audience)
+		pair, err := a.Login(c, req.Email, req.Password)
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+		res.pair(c, pair)
+	}
+}
+
+func resendVerification(a app.App, res responses) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req EmailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			handleBindError(c, &req, err, ErrBadRequest)
+			return
+		}
+		if err := a.ResendVerification(c, req.Email); err != nil {
+			handleError(c, err)
+			return
+		}
+		res.data(c, http.StatusAccepted, nil)
+	}
+}
+
+func verifyEmail(a app.App, res responses) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req VerifyEmailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			handleBindError(c, &req, err, ErrBadRequest)
+			return
+		}
+		if err := a.VerifyEmail(c, req.Email, req.Token); err != nil {
+			handleError(c, err)
+			return
+		}
+		res.data(c, http.StatusOK, nil)
+	}
+}
+
+func forgotPassword(a app.App, res responses) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req EmailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			handleBindError(c, &req, err, ErrBadRequest)
+			return
+		}
+		if err := a.ForgotPassword(c, req.Email); err != nil {
+			handleError(c, err)
+			return
+		}
+		res.data(c, http.StatusAccepted, nil)
+	}
+}
+
+func resetPassword(a app.App, res responses) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ResetPasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			handleBindError(c, &req, err, ErrBadRequest)
+			return
+		}
+		if err := a.ResetPassword(c, req.Email, req.Token, req.Password); err != nil {
+			handleError(c, err)
+			return
+		}
+		res.data(c, http.StatusOK, nil)
+	}
+}
+
+func adminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			handleError(c, ErrUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
+
+func unlockUser(a app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := a.Unlock(c, c.Param("id")); err != nil {
+			handleError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, successResponse(nil))
+	}
+}
+
+func unlockIP(a app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := a.UnlockIP(c, c.Param("ip")); err != nil {
+			handleError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, successResponse(nil))
+	}
+}
+
+func requestURL(c *gin.Context, publicURL string) string {
+	if publicURL != "" {
+		return publicURL + c.Request.URL.Path
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + c.Request.URL.Path
+}
+
+// dpop verifies the DPoP proof header, if any, and stores the thumbprint of the proof key
+func dpop(a app.App, publicURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		proofs := c.Request.Header.Values("DPoP")
+		if len(proofs) == 0 {
+			c.Next()
+			return
+		}
+		if len(proofs) > 1 {
+			handleError(c, app.ErrInvalidProof)
+			return
+		}
+		jkt, err := a.VerifyDPoP(c, proofs[0], c.Request.Method, requestURL(c, publicURL))
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+		c.Set(app.CtxDPoPJKT, jkt)
+		c.Next()
+	}
+}
+
+// responses are the shapes of successful responses of an API version
+type responses struct {
+	pair func(c *gin.Context, pair entities.JWTPair)
+	data func(c *gin.Context, status int, data any)
+}
+
+var (
+	legacyResponses = responses{pair: legacyPair, data: envelopeData}
+	v2Responses     = responses{pair: oauth2Pair, data: plainData}
+)
+
+func legacyPair(c *gin.Context, pair entities.JWTPair) {
+	c.JSON(http.StatusOK, jwtSuccessResponse(pair))
+}
+
+// oauth2Pair writes the OAuth 2.0 token response, which must not be cached
+func oauth2Pair(c *gin.Context, pair entities.JWTPair) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, tokenToResponse(pair, time.Now()))
+}
+
+func envelopeData(c *gin.Context, status int, data any) {
+	c.JSON(status, successResponse(data))
+}
+
+// plainData writes the data without the envelope, or no body if there is no data
+func plainData(c *gin.Context, status int, data any) {
+	if data == nil {
+		if status == http.StatusOK {
+			status = http.StatusNoContent
+		}
+		c.Status(status)
+		return
 	}
+	c.JSON(status, data)
 }
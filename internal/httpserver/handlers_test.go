@@ -0,0 +1,38 @@
+package httpserver
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGeneratePair_responses(t *testing.T) {
+	srv := newTestServer(t, WithProblemDetails())
+	generate := func(path string) *httptest.ResponseRecorder {
+		rec := do(srv, http.MethodPost, path, `{"user_id":"`+testUserID+`"}`)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		return rec
+	}
+
+	t.Run("legacy", func(t *testing.T) {
+		resp := decode[dataEnvelope[JWTPairResponse]](t, generate("/api/v1/generate"), http.StatusOK)
+		assert.NotEmpty(t, resp.Data.Access)
+		assert.NotEmpty(t, resp.Data.Refresh)
+		assert.Nil(t, resp.Error)
+	})
+
+	t.Run("oauth2", func(t *testing.T) {
+		rec := generate("/api/v2/generate")
+		assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+		resp := decode[map[string]any](t, rec, http.StatusOK)
+		assert.NotEmpty(t, resp["access_token"])
+		assert.NotEmpty(t, resp["refresh_token"])
+		assert.Equal(t, "Bearer", resp["token_type"])
+		assert.InDelta(t, time.Minute.Seconds(), resp["expires_in"], 1)
+		assert.InDelta(t, time.Hour.Seconds(), resp["refresh_expires_in"], 1)
+		assert.NotContains(t, resp, "scope")
+	})
+}
@@ -0,0 +1,35 @@
+package httpserver
+
+import (
+	"github.com/stretchr/testify/assert"
+	"jwt-auth/internal/app"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestIntrospect(t *testing.T) {
+	srv := newAppServer(t, newTestApp(app.WithOpaqueAccess(app.OpaqueAllClients)), WithIntrospection("resource-token"))
+
+	const form = "application/x-www-form-urlencoded"
+	introspect := func(token string) IntrospectionResponse {
+		rec := do(srv, http.MethodPost, "/api/introspect", url.Values{"token": {token}}.Encode(),
+			"Content-Type", form, "Authorization", "Bearer resource-token")
+		return decode[IntrospectionResponse](t, rec, http.StatusOK)
+	}
+
+	gen := decodePair(t, do(srv, http.MethodPost, "/api/generate", `{"user_id":"`+testUserID+`"}`))
+	got := introspect(gen.Access)
+	assert.True(t, got.Active)
+	assert.Equal(t, testUserID, got.Subject)
+	assert.Equal(t, "Bearer", got.TokenType)
+
+	rec := do(srv, http.MethodPost, "/api/introspect", url.Values{"token": {gen.Access}}.Encode(), "Content-Type", form)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "resource server is not authorized")
+
+	ref := decodePair(t, do(srv, http.MethodPut, "/api/refresh", `{"refresh":"`+gen.Refresh+`"}`))
+	assert.False(t, introspect(gen.Access).Active, "rotated access token is revoked at once")
+	assert.True(t, introspect(ref.Access).Active)
+	assert.Equal(t, `{"active":false}`, do(srv, http.MethodPost, "/api/introspect", "token=unknown.token",
+		"Content-Type", form, "Authorization", "Bearer resource-token").Body.String())
+}
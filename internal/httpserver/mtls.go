@@ -0,0 +1,33 @@
+package httpserver
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"jwt-auth/internal/app"
+	"slices"
+)
+
+var ErrUnknownClient = errors.New("client certificate is not allowed")
+
+// clientCert authenticates the client by the verified certificate and stores
+// the certificate thumbprint for binding tokens (RFC 8705)
+func clientCert(allowed []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			c.Next()
+			return
+		}
+		cert := c.Request.TLS.VerifiedChains[0][0]
+		clientID := cert.Subject.CommonName
+		if len(allowed) > 0 && !slices.Contains(allowed, clientID) {
+			handleError(c, ErrUnknownClient)
+			return
+		}
+		sum := sha256.Sum256(cert.Raw)
+		c.Set(app.CtxClientID, clientID)
+		c.Set(app.CtxX5TS256, base64.RawURLEncoding.EncodeToString(sum[:]))
+		c.Next()
+	}
+}
@@ -0,0 +1,69 @@
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func certificate(t *testing.T, cn string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestClientCert(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(clientCert([]string{"service-a"}))
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(app.CtxClientID)+" "+c.GetString(app.CtxX5TS256))
+	})
+
+	request := func(cert *x509.Certificate) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	cert := certificate(t, "service-a")
+	sum := sha256.Sum256(cert.Raw)
+	rec := request(cert)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "service-a "+base64.RawURLEncoding.EncodeToString(sum[:]), rec.Body.String())
+
+	rec = request(nil)
+	require.Equal(t, http.StatusOK, rec.Code, "no certificate")
+	assert.Equal(t, " ", rec.Body.String())
+
+	rec = request(certificate(t, "service-b"))
+	assert.Equal(t, http.StatusForbidden, rec.Code, "not allowed client")
+}
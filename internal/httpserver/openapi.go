@@ -0,0 +1,271 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// operation describes a route in the OpenAPI document
+type operation struct {
+	summary string
+	// request is the DTO of the body, nil if there is none. requestV2 replaces it in v2
+	request   any
+	requestV2 any
+	// pair responses are the token pair, otherwise the response has status and data
+	pair   bool
+	status int
+	data   any
+	// dpop routes accept the DPoP proof header
+	dpop bool
+}
+
+// spec is the OpenAPI document. Maps keep the JSON output sorted and so stable
+type spec map[string]any
+
+// openAPI builds the OpenAPI 3.1 document of the routes and of the other routes enabled
+// by the options. v1 operations have the envelope and the legacy errors, like the handlers
+func openAPI(base string, routes []route, o options) []byte {
+	s := specBuilder{schemas: make(spec), paths: make(spec), problems: o.problemDetails}
+	for _, rt := range routes {
+		s.add(base+"/v1"+rt.path, rt.method, s.operation(rt.doc, 1))
+		s.add(base+"/v2"+rt.path, rt.method, s.operation(rt.doc, 2))
+		op := s.operation(rt.doc, 1)
+		op["description"] = "Serves v2 with the Accept: " + mediaTypeV2 + " header, v1 otherwise"
+		s.add(base+rt.path, rt.method, op)
+	}
+	s.add(base+"/ping", http.MethodGet, spec{
+		"summary":   "Check the service is up",
+		"responses": spec{"200": spec{"description": "pong"}},
+	})
+	s.add(base+"/openapi.json", http.MethodGet, spec{
+		"summary":   "This document",
+		"responses": spec{"200": spec{"description": "OpenAPI document"}},
+	})
+	if o.introspectToken != "" {
+		s.add(base+"/introspect", http.MethodPost, spec{
+			"summary":  "Introspect the access token (RFC 7662)",
+			"security": []spec{{"bearer": []string{}}},
+			"requestBody": spec{
+				"required": true,
+				"content": spec{"application/x-www-form-urlencoded": spec{"schema": spec{
+					"type":       "object",
+					"properties": spec{"token": spec{"type": "string"}},
+					"required":   []string{"token"},
+				}}},
+			},
+			"responses": s.responses(http.StatusOK, s.schema(reflect.TypeOf(IntrospectionResponse{})), s.problems),
+		})
+	}
+	if o.adminToken != "" {
+		admin := map[string]string{
+			"/admin/lockouts/users/:id": "Unlock the user",
+			"/admin/lockouts/ips/:ip":   "Unlock the IP address",
+		}
+		for path, summary := range admin {
+			s.add(base+path, http.MethodDelete, spec{
+				"summary":   summary,
+				"security":  []spec{{"bearer": []string{}}},
+				"responses": s.responses(http.StatusOK, envelope(nil), s.problems),
+			})
+		}
+	}
+
+	doc := spec{
+		"openapi": "3.1.0",
+		"info":    spec{"title": "jwt-auth", "version": "2"},
+		"paths":   s.paths,
+		"components": spec{
+			"schemas":         s.schemas,
+			"securitySchemes": spec{"bearer": spec{"type": "http", "scheme": "bearer"}},
+		},
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		// the document has only maps, slices and strings
+		panic(err)
+	}
+	return b
+}
+
+type specBuilder struct {
+	schemas  spec
+	paths    spec
+	problems bool
+}
+
+// add puts the operation to the path in the OpenAPI form, e.g. /users/{id} for /users/:id
+func (s specBuilder) add(path string, method string, op spec) {
+	var params []spec
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if name, ok := strings.CutPrefix(seg, ":"); ok {
+			segments[i] = "{" + name + "}"
+		}
+		if name, ok := strings.CutPrefix(segments[i], "{"); ok {
+			params = append(params, spec{
+				"name":     strings.TrimSuffix(name, "}"),
+				"in":       "path",
+				"required": true,
+				"schema":   spec{"type": "string"},
+			})
+		}
+	}
+	if len(params) > 0 {
+		headers, _ := op["parameters"].([]spec)
+		op["parameters"] = append(params, headers...)
+	}
+	path = strings.Join(segments, "/")
+	item, ok := s.paths[path].(spec)
+	if !ok {
+		item = make(spec)
+		s.paths[path] = item
+	}
+	item[strings.ToLower(method)] = op
+}
+
+func (s specBuilder) operation(doc operation, version int) spec {
+	op := spec{"summary": doc.summary}
+	request := doc.request
+	if version == 2 && doc.requestV2 != nil {
+		request = doc.requestV2
+	}
+	if request != nil {
+		op["requestBody"] = spec{
+			"required": true,
+			"content":  spec{"application/json": spec{"schema": s.schema(reflect.TypeOf(request))}},
+		}
+	}
+	if doc.dpop {
+		op["parameters"] = []spec{{
+			"name":        "DPoP",
+			"in":          "header",
+			"description": "DPoP proof (RFC 9449) binding the issued tokens to its key",
+			"schema":      spec{"type": "string"},
+		}}
+	}
+
+	var data spec
+	status := doc.status
+	switch {
+	case doc.pair && version == 2:
+		status, data = http.StatusOK, s.schema(reflect.TypeOf(TokenResponse{}))
+	case doc.pair:
+		status, data = http.StatusOK, s.schema(reflect.TypeOf(JWTPairResponse{}))
+	case doc.data != nil:
+		data = s.schema(reflect.TypeOf(doc.data))
+	}
+	if version == 1 {
+		op["deprecated"] = true
+		op["responses"] = s.responses(status, envelope(data), false)
+		return op
+	}
+	if data == nil && status == http.StatusOK {
+		status = http.StatusNoContent
+	}
+	op["responses"] = s.responses(status, data, true)
+	return op
+}
+
+// envelope is the {"data", "error"} wrapper of v1 responses
+func envelope(data spec) spec {
+	if data == nil {
+		data = spec{"type": "null"}
+	}
+	return spec{
+		"type": "object",
+		"properties": spec{
+			"data":  data,
+			"error": spec{"type": "null"},
+		},
+		"required": []string{"data", "error"},
+	}
+}
+
+// responses has the success response and the error one. Errors are RFC 7807 problems
+// or the v1 envelope with the message
+func (s specBuilder) responses(status int, data spec, problems bool) spec {
+	success := spec{"description": http.StatusText(status)}
+	if data != nil {
+		success["content"] = spec{"application/json": spec{"schema": data}}
+	}
+	failure := spec{"description": "Error"}
+	if problems {
+		failure["content"] = spec{problemContentType: spec{"schema": s.schema(reflect.TypeOf(ProblemResponse{}))}}
+	} else {
+		failure["content"] = spec{"application/json": spec{"schema": spec{
+			"type": "object",
+			"properties": spec{
+				"data":  spec{"type": "null"},
+				"error": spec{"type": "string"},
+			},
+			"required": []string{"data", "error"},
+		}}}
+	}
+	return spec{strconv.Itoa(status): success, "default": failure}
+}
+
+// schema describes the type. Structs are put to the components by the name and referenced.
+// Fields are named by the json tags and required by the binding or the lack of omitempty
+func (s specBuilder) schema(t reflect.Type) spec {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.schema(t.Elem())
+	case reflect.String:
+		return spec{"type": "string"}
+	case reflect.Bool:
+		return spec{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return spec{"type": "integer"}
+	case reflect.Slice, reflect.Array:
+		return spec{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return spec{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		ref := spec{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := s.schemas[t.Name()]; ok {
+			return ref
+		}
+		props := make(spec)
+		s.schemas[t.Name()] = spec{"type": "object", "properties": props}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = s.schema(f.Type)
+			if strings.Contains(f.Tag.Get("binding"), "required") ||
+				(f.Tag.Get("binding") == "" && !strings.Contains(opts, "omitempty") && !isRequest(t)) {
+				required = append(required, name)
+			}
+		}
+		if len(required) > 0 {
+			s.schemas[t.Name()].(spec)["required"] = required
+		}
+		return ref
+	}
+	return spec{}
+}
+
+// isRequest tells request DTOs, whose fields are optional unless bound as required,
+// from responses, whose fields are always present unless omitted when empty
+func isRequest(t reflect.Type) bool {
+	return strings.HasSuffix(t.Name(), "Request")
+}
+
+// basePath returns the prefix of the routes of the router, e.g. /api
+func basePath(r gin.IRouter) string {
+	if g, ok := r.(interface{ BasePath() string }); ok {
+		return strings.TrimSuffix(g.BasePath(), "/")
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package httpserver
+
+import (
+	"flag"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// TestOpenAPI fails when a route or a DTO changes and the document in testdata does not.
+// Run "go test ./internal/httpserver -run TestOpenAPI -update" and review the diff
+func TestOpenAPI(t *testing.T) {
+	const golden = "testdata/openapi.json"
+	srv := newTestServer(t, WithAdminToken("admin"), WithIntrospection("introspect"))
+
+	rec := do(srv, http.MethodGet, "/api/openapi.json", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	if *update {
+		require.NoError(t, os.WriteFile(golden, append(rec.Body.Bytes(), '\n'), 0o644))
+	}
+	want, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(want), rec.Body.String(), "the document is outdated, see the test comment")
+
+	doc := decode[struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}](t, rec, http.StatusOK)
+	param := regexp.MustCompile(`:(\w+)`)
+	for _, r := range srv.Handler.(*gin.Engine).Routes() {
+		if r.Method != http.MethodGet && strings.HasSuffix(r.Path, "/ping") {
+			// Any registers every method, the document has GET
+			continue
+		}
+		path := param.ReplaceAllString(r.Path, "{$1}")
+		assert.Contains(t, doc.Paths[path], strings.ToLower(r.Method), "%s %s is not described", r.Method, r.Path)
+	}
+}
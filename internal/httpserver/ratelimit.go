@@ -0,0 +1,122 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwt-auth/internal/app"
+	"jwt-auth/internal/logger"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimiter is a token bucket storage. The bucket of the key holds up to burst tokens
+// and is refilled completely during the period
+type RateLimiter interface {
+	// Take removes a token from the bucket. When the bucket is empty it returns false
+	// and the time until the next token is available
+	Take(ctx context.Context, key string, burst int, period time.Duration) (bool, time.Duration, error)
+}
+
+// Rule allows Burst requests per Period. Zero rule means no limit
+type Rule struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ParseRule parses rules in the "<burst>/<period>" format, e.g. "10/1m"
+func ParseRule(s string) (Rule, error) {
+	if s == "" {
+		return Rule{}, nil
+	}
+	burst, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("invalid rate limit rule %q", s)
+	}
+	b, err := strconv.Atoi(burst)
+	if err != nil || b <= 0 {
+		return Rule{}, fmt.Errorf("invalid rate limit burst %q", s)
+	}
+	p, err := time.ParseDuration(period)
+	if err != nil || p <= 0 {
+		return Rule{}, fmt.Errorf("invalid rate limit period %q", s)
+	}
+	return Rule{Burst: b, Period: p}, nil
+}
+
+// RateLimits are applied independently per route. Routes are keyed by the full
+// path, e.g. "/api/generate"
+type RateLimits struct {
+	IP           Rule
+	Client       Rule
+	RoutesIP     map[string]Rule
+	RoutesClient map[string]Rule
+}
+
+func (l RateLimits) rules(route string) (Rule, Rule) {
+	ip, client := l.IP, l.Client
+	if r, ok := l.RoutesIP[route]; ok {
+		ip = r
+	}
+	if r, ok := l.RoutesClient[route]; ok {
+		client = r
+	}
+	return ip, client
+}
+
+// clientID returns the client authenticated by the certificate or, if there is none,
+// the subject of the bearer access token
+func clientID(c *gin.Context, a app.App) string {
+	if id := c.GetString(app.CtxClientID); id != "" {
+		return id
+	}
+	if access, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		if userID, err := a.Subject(c, access); err == nil {
+			return userID
+		}
+	}
+	return ""
+}
+
+func rateLimit(a app.App, limiter RateLimiter, limits RateLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := unversioned(c.FullPath())
+		if route == "" {
+			c.Next()
+			return
+		}
+		ipRule, clientRule := limits.rules(route)
+		if ok := take(c, limiter, ipRule, "ip:"+route+":"+c.ClientIP()); !ok {
+			return
+		}
+		if id := clientID(c, a); id != "" {
+			if ok := take(c, limiter, clientRule, "client:"+route+":"+id); !ok {
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// take aborts the request when the bucket is empty. Storage errors do not block requests
+func take(c *gin.Context, limiter RateLimiter, rule Rule, key string) bool {
+	if rule.Burst == 0 {
+		return true
+	}
+	ok, retry, err := limiter.Take(c, key, rule.Burst, rule.Period)
+	if err != nil {
+		logger.Log(c).Error("rate limiter error", slog.String("error", err.Error()))
+		return true
+	}
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		handleError(c, ErrRateLimited)
+	}
+	return ok
+}
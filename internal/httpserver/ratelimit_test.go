@@ -0,0 +1,57 @@
+package httpserver
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/adapters/memory"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    Rule
+		wantErr bool
+	}{
+		{rule: "10/1m", want: Rule{Burst: 10, Period: time.Minute}},
+		{rule: "", want: Rule{}},
+		{rule: "10", wantErr: true},
+		{rule: "0/1m", wantErr: true},
+		{rule: "10/minute", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRule(tt.rule)
+		if tt.wantErr {
+			assert.Errorf(t, err, "ParseRule(%q)", tt.rule)
+			continue
+		}
+		require.NoErrorf(t, err, "ParseRule(%q)", tt.rule)
+		assert.Equalf(t, tt.want, got, "ParseRule(%q)", tt.rule)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := newTestServer(t, WithRateLimit(memory.NewRateLimiter(), RateLimits{
+		IP:       Rule{Burst: 5, Period: time.Minute},
+		RoutesIP: map[string]Rule{"/api/ping": {Burst: 2, Period: time.Minute}},
+	}))
+
+	ping := func(remote string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+		req.RemoteAddr = remote
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	require.Equal(t, http.StatusOK, ping("192.0.2.1:1000").Code)
+	require.Equal(t, http.StatusOK, ping("192.0.2.1:1000").Code)
+
+	rec := ping("192.0.2.1:1000")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code, "route limit exceeded")
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+
+	require.Equal(t, http.StatusOK, ping("192.0.2.2:1000").Code, "another IP")
+}
@@ -0,0 +1,34 @@
+package httpserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	headerRequestID = "X-Request-ID"
+	// maxRequestID limits IDs passed by clients and proxies, longer ones are replaced
+	maxRequestID = 128
+)
+
+// Keys of values stored in the gin context by the middlewares of the package
+const (
+	ctxRequestID      = "request_id"
+	ctxProblemDetails = "problem_details"
+)
+
+// requestID takes the request ID from the X-Request-ID header or generates it and
+// returns it in the same header of the response
+func requestID(c *gin.Context) {
+	id := c.GetHeader(headerRequestID)
+	if id == "" || len(id) > maxRequestID {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err == nil {
+			id = hex.EncodeToString(b)
+		}
+	}
+	c.Set(ctxRequestID, id)
+	c.Header(headerRequestID, id)
+	c.Next()
+}
@@ -6,13 +6,134 @@ import (
 	"net/http"
 )
 
-func SetRoutes(r gin.IRouter, a app.App) {
-	r.Any("/ping", func(c *gin.Context) {
+// route has a handler per API version. Middlewares are the same in every version
+type route struct {
+	method     string
+	path       string
+	middleware []gin.HandlerFunc
+	v1         gin.HandlerFunc
+	v2         gin.HandlerFunc
+	doc        operation
+}
+
+// SetRoutes registers the routes under /v1 and /v2 and without a version. Routes without
+// a version serve the version requested by the Accept header, v1 by default. v1 is frozen:
+// it keeps the {"data", "error"} envelope whatever the options and is deprecated. v2 has
+// OAuth 2.0 token responses, RFC 7807 errors and no envelope. The routes are described
+// by /openapi.json
+func SetRoutes(r gin.IRouter, a app.App, opts ...Option) {
+	o := newOptions(opts)
+	proof := dpop(a, o.publicURL)
+	v1, v2 := legacyResponses, v2Responses
+	if o.refreshCookie != nil {
+		v1.pair = o.refreshCookie.setCookies(v1.pair)
+		v2.pair = o.refreshCookie.setCookies(v2.pair)
+	}
+
+	// the version is selected first, so that even rate limit errors have its shape
+	var limit []gin.HandlerFunc
+	if o.limiter != nil {
+		limit = append(limit, rateLimit(a, o.limiter, o.limits))
+	}
+
+	r.Any("/ping", append(limit, func(c *gin.Context) {
 		c.String(http.StatusOK, "pong")
+	})...)
+
+	routes := []route{
+		{
+			// Метод POST, т.к. запрос предполагает возможность добавления в БД запись
+			method:     http.MethodPost,
+			path:       "/generate",
+			middleware: []gin.HandlerFunc{proof},
+			v1:         generatePair(a, v1),
+			v2:         generatePair(a, v2),
+			doc:        operation{summary: "Issue a token pair for the user", request: GenerateRequest{}, pair: true, dpop: true},
+		},
+		{
+			// Метод PUT, т.к. запрос изменяет только существующие записи
+			method:     http.MethodPut,
+			path:       "/refresh",
+			middleware: []gin.HandlerFunc{proof},
+			v1:         refreshPair(a, v1, o.refreshCookie),
+			v2:         refreshToken(a, v2, o.refreshCookie),
+			doc: operation{
+				summary:   "Rotate the token pair",
+				request:   RefreshRequest{},
+				requestV2: RefreshTokenRequest{},
+				pair:      true,
+				dpop:      true,
+			},
+		},
+		{
+			method: http.MethodPost,
+			path:   "/register",
+			v1:     register(a, v1),
+			v2:     register(a, v2),
+			doc:    operation{summary: "Register an account", request: RegisterRequest{}, status: http.StatusCreated, data: RegisterResponse{}},
+		},
+		{
+			method:     http.MethodPost,
+			path:       "/login",
+			middleware: []gin.HandlerFunc{proof},
+			v1:         login(a, v1),
+			v2:         login(a, v2),
+			doc:        operation{summary: "Log in with the email and the password", request: LoginRequest{}, pair: true, dpop: true},
+		},
+		{
+			method: http.MethodPost,
+			path:   "/email/verify",
+			v1:     resendVerification(a, v1),
+			v2:     resendVerification(a, v2),
+			doc:    operation{summary: "Send the email verification token again", request: EmailRequest{}, status: http.StatusAccepted},
+		},
+		{
+			method: http.MethodPut,
+			path:   "/email/verify",
+			v1:     verifyEmail(a, v1),
+			v2:     verifyEmail(a, v2),
+			doc:    operation{summary: "Verify the email", request: VerifyEmailRequest{}, status: http.StatusOK},
+		},
+		{
+			method: http.MethodPost,
+			path:   "/password/forgot",
+			v1:     forgotPassword(a, v1),
+			v2:     forgotPassword(a, v2),
+			doc:    operation{summary: "Send the password reset token", request: EmailRequest{}, status: http.StatusAccepted},
+		},
+		{
+			// Сброс пароля отзывает refresh-токен пользователя
+			method: http.MethodPut,
+			path:   "/password/reset",
+			v1:     resetPassword(a, v1),
+			v2:     resetPassword(a, v2),
+			doc:    operation{summary: "Reset the password and revoke the refresh token", request: ResetPasswordRequest{}, status: http.StatusOK},
+		},
+	}
+
+	groups := []struct {
+		router  gin.IRouter
+		version gin.HandlerFunc
+	}{
+		{r.Group("/v1"), apiVersion(1, o.v1Deprecated, o.v1Sunset)},
+		{r.Group("/v2"), apiVersion(2, o.v1Deprecated, o.v1Sunset)},
+		{r, negotiate(o.v1Deprecated, o.v1Sunset)},
+	}
+	for _, g := range groups {
+		for _, rt := range routes {
+			handlers := append([]gin.HandlerFunc{g.version}, limit...)
+			handlers = append(handlers, rt.middleware...)
+			g.router.Handle(rt.method, rt.path, append(handlers, byVersion(rt.v1, rt.v2))...)
+		}
+	}
+
+	spec := openAPI(basePath(r), routes, o)
+	r.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", spec)
 	})
+}
 
-	// Метод POST, т.к. запрос предполагает возможность добавления в БД запись
-	r.POST("/generate", generatePair(a))
-	// Метод PUT, т.к. запрос изменяет только существующие записи
-	r.PUT("/refresh", refreshPair(a))
+func SetAdminRoutes(r gin.IRouter, a app.App) {
+	r.DELETE("/lockouts/users/:id", unlockUser(a))
+	r.DELETE("/lockouts/ips/:ip", unlockIP(a))
 }
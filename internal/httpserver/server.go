@@ -2,6 +2,8 @@ package httpserver
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -9,32 +11,184 @@ import (
 	"jwt-auth/internal/logger"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type Server struct {
 	http.Server
-	log *slog.Logger
+	log      *slog.Logger
+	certFile string
+	keyFile  string
 }
 
-func New(log *slog.Logger, addr string, mode string, a app.App) *Server {
+type options struct {
+	adminToken      string
+	introspectToken string
+	trustedProxies  []string
+	limiter         RateLimiter
+	limits          RateLimits
+	publicURL       string
+	certFile        string
+	keyFile         string
+	clientCAs       *x509.CertPool
+	requireCert     bool
+	allowedClients  []string
+	problemDetails  bool
+	v1Deprecated    time.Time
+	v1Sunset        time.Time
+	refreshCookie   *RefreshCookie
+	cors            *CORS
+}
+
+func newOptions(opts []Option) options {
+	o := options{v1Deprecated: v2Released}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+type Option func(o *options)
+
+// WithAdminToken enables /api/admin routes authorized by the bearer token
+func WithAdminToken(token string) Option {
+	return func(o *options) {
+		o.adminToken = token
+	}
+}
+
+// WithIntrospection enables the /api/introspect route (RFC 7662) for resource servers
+// authorized by the bearer token
+func WithIntrospection(token string) Option {
+	return func(o *options) {
+		o.introspectToken = token
+	}
+}
+
+// WithTrustedProxies sets proxies allowed to pass the client IP in X-Forwarded-For.
+// By default no proxy is trusted and the client IP is the remote address
+func WithTrustedProxies(proxies []string) Option {
+	return func(o *options) {
+		o.trustedProxies = proxies
+	}
+}
+
+// WithRateLimit enables token bucket rate limits on /api routes
+func WithRateLimit(limiter RateLimiter, limits RateLimits) Option {
+	return func(o *options) {
+		o.limiter = limiter
+		o.limits = limits
+	}
+}
+
+// WithPublicURL sets the external base URL of the service, e.g. https://auth.example.com,
+// which DPoP proofs are checked against. By default it is built from the request
+func WithPublicURL(url string) Option {
+	return func(o *options) {
+		o.publicURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithProblemDetails returns errors of the routes without a version, e.g. /introspect
+// and /admin, as application/problem+json (RFC 7807) with stable codes instead of the
+// {"data", "error"} envelope. v1 routes keep the envelope, v2 ones always have problems
+func WithProblemDetails() Option {
+	return func(o *options) {
+		o.problemDetails = true
+	}
+}
+
+// WithTLS serves HTTPS using the certificate and the key files
+func WithTLS(certFile string, keyFile string) Option {
+	return func(o *options) {
+		o.certFile = certFile
+		o.keyFile = keyFile
+	}
+}
+
+// WithClientCA enables mutual TLS. Client certificates are verified against the pool
+// and are required if require is set. Clients are identified by the certificate
+// subject common name, and the allowed list restricts it when not empty
+func WithClientCA(pool *x509.CertPool, require bool, allowed []string) Option {
+	return func(o *options) {
+		o.clientCAs = pool
+		o.requireCert = require
+		o.allowedClients = allowed
+	}
+}
+
+func New(log *slog.Logger, addr string, mode string, a app.App, opts ...Option) (*Server, error) {
 	gin.SetMode(mode)
+	o := newOptions(opts)
+	if !o.v1Sunset.IsZero() && o.v1Sunset.Before(o.v1Deprecated) {
+		return nil, fmt.Errorf("v1 sunset %s is before its deprecation %s",
+			o.v1Sunset.Format(time.DateOnly), o.v1Deprecated.Format(time.DateOnly))
+	}
+	if o.cors != nil {
+		if err := o.cors.validate(); err != nil {
+			return nil, err
+		}
+	}
 
 	r := gin.New()
+	// gin keeps the proxies parsed before an invalid one, so the server must not start
+	if err := r.SetTrustedProxies(o.trustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
 	r.Use(gin.Recovery())
+	r.Use(requestID)
+	if o.problemDetails {
+		r.Use(problemDetails)
+	}
 	logMW := logger.Middleware(log)
 	r.Use(func(c *gin.Context) {
 		logMW(c.Request, c.Set, c.Next)
 	})
+	r.Use(func(c *gin.Context) {
+		c.Set(app.CtxClientIP, c.ClientIP())
+		c.Next()
+	})
 	s := Server{
 		Server: http.Server{
 			Addr:    addr,
 			Handler: r,
 		},
-		log: log,
+		log:      log,
+		certFile: o.certFile,
+		keyFile:  o.keyFile,
+	}
+	if o.clientCAs != nil {
+		s.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ClientCAs:  o.clientCAs,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+		}
+		if o.requireCert {
+			s.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		r.Use(clientCert(o.allowedClients))
+	}
+	api := r.Group("/api")
+	if o.cors != nil {
+		api.Use(o.cors.middleware())
 	}
-	SetRoutes(r.Group("/api"), a)
-	return &s
+	// versioned routes are limited by SetRoutes itself
+	SetRoutes(api, a, opts...)
+	other := api.Group("")
+	if o.limiter != nil {
+		other.Use(rateLimit(a, o.limiter, o.limits))
+	}
+	if o.adminToken != "" {
+		SetAdminRoutes(other.Group("/admin", adminAuth(o.adminToken)), a)
+	}
+	if o.introspectToken != "" {
+		other.POST("/introspect", adminAuth(o.introspectToken), introspect(a))
+	}
+	if o.cors != nil {
+		preflightRoutes(r, api)
+	}
+	return &s, nil
 }
 
 func (s *Server) Listen(ctx context.Context) error {
@@ -49,7 +203,13 @@ func (s *Server) Listen(ctx context.Context) error {
 	}()
 
 	go func() {
-		if err := s.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if s.certFile != "" {
+			err = s.ListenAndServeTLS(s.certFile, s.keyFile)
+		} else {
+			err = s.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
 			errCh <- err
 		}
 	}()
@@ -0,0 +1,76 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/adapters/bcrypt"
+	"jwt-auth/internal/adapters/memory"
+	"jwt-auth/internal/app"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testUserID = "f47ac10b-58cc-4372-a567-0e02b2c3d479"
+
+// newTestApp is the app of test servers: tokens in memory, access tokens live for
+// a minute and refresh tokens for an hour
+func newTestApp(opts ...app.Option) app.App {
+	return app.New(memory.NewRepo(), bcrypt.New(4), "secret", time.Minute, time.Hour, opts...)
+}
+
+// newTestServer serves the routes of a new test app
+func newTestServer(t *testing.T, opts ...Option) *Server {
+	return newAppServer(t, newTestApp(), opts...)
+}
+
+func newAppServer(t *testing.T, a app.App, opts ...Option) *Server {
+	t.Helper()
+	srv, err := New(slog.Default(), "", gin.ReleaseMode, a, opts...)
+	require.NoError(t, err)
+	return srv
+}
+
+// do serves the request with the JSON body. Headers are name and value pairs and
+// may replace the Content-Type
+func do(srv *Server, method string, path string, body string, headers ...string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	srv.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// decode requires the status and returns the body
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder, status int) T {
+	t.Helper()
+	require.Equal(t, status, rec.Code, rec.Body.String())
+	var v T
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &v))
+	return v
+}
+
+// dataEnvelope is the v1 response body
+type dataEnvelope[T any] struct {
+	Data  T       `json:"data"`
+	Error *string `json:"error"`
+}
+
+// decodePair requires the pair in the v1 envelope
+func decodePair(t *testing.T, rec *httptest.ResponseRecorder) JWTPairResponse {
+	t.Helper()
+	return decode[dataEnvelope[JWTPairResponse]](t, rec, http.StatusOK).Data
+}
+
+func TestNew_trustedProxies(t *testing.T) {
+	_, err := New(slog.Default(), "", gin.ReleaseMode, newTestApp(), WithTrustedProxies([]string{"10.0.0.0/8", "proxy"}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,90 @@
+package httpserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// mediaTypeV2 in the Accept header selects v2 on routes without a version
+	mediaTypeV2   = "application/vnd.jwt-auth.v2+json"
+	ctxAPIVersion = "api_version"
+)
+
+// v2Released is the release date of v2, which deprecated v1. It is the default
+// of the Deprecation header
+var v2Released = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// WithV1Sunset announces the date v1 routes will be removed in the Sunset header (RFC 8594).
+// It must not be before the deprecation date
+func WithV1Sunset(sunset time.Time) Option {
+	return func(o *options) {
+		o.v1Sunset = sunset
+	}
+}
+
+// WithV1Deprecated sets the date in the Deprecation header of v1 responses instead of
+// the release date of v2, e.g. for deployments which got v2 later
+func WithV1Deprecated(deprecated time.Time) Option {
+	return func(o *options) {
+		o.v1Deprecated = deprecated
+	}
+}
+
+// apiVersion selects the version of the request. v1 responses have the deprecation
+// headers and the legacy errors even with WithProblemDetails, v2 errors are RFC 7807 ones
+func apiVersion(version int, deprecated time.Time, sunset time.Time) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ctxAPIVersion, version)
+		if version == 1 {
+			c.Set(ctxProblemDetails, false)
+			c.Header("Deprecation", "@"+strconv.FormatInt(deprecated.Unix(), 10))
+			if !sunset.IsZero() {
+				c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+		} else {
+			c.Set(ctxProblemDetails, true)
+		}
+		c.Next()
+	}
+}
+
+// negotiate selects the version by the Accept header
+func negotiate(deprecated time.Time, sunset time.Time) gin.HandlerFunc {
+	v1, v2 := apiVersion(1, deprecated, sunset), apiVersion(2, deprecated, sunset)
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept")
+		for _, accept := range strings.Split(c.GetHeader("Accept"), ",") {
+			if mediaType, _, err := mime.ParseMediaType(accept); err == nil && mediaType == mediaTypeV2 {
+				v2(c)
+				return
+			}
+		}
+		v1(c)
+	}
+}
+
+func byVersion(v1 gin.HandlerFunc, v2 gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetInt(ctxAPIVersion) == 2 {
+			v2(c)
+			return
+		}
+		v1(c)
+	}
+}
+
+// unversioned removes the version from the route, so the versions of a route share
+// its rate limits
+func unversioned(route string) string {
+	for _, v := range []string{"/v1/", "/v2/"} {
+		if before, after, ok := strings.Cut(route, v); ok {
+			return before + "/" + after
+		}
+	}
+	return route
+}
@@ -0,0 +1,86 @@
+package httpserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUnversioned(t *testing.T) {
+	assert.Equal(t, "/api/generate", unversioned("/api/v1/generate"))
+	assert.Equal(t, "/api/email/verify", unversioned("/api/v2/email/verify"))
+	assert.Equal(t, "/api/generate", unversioned("/api/generate"))
+}
+
+func TestVersions(t *testing.T) {
+	sunset := time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+	srv := newTestServer(t, WithV1Sunset(sunset))
+
+	call := func(method string, path string, body string, accept string) *httptest.ResponseRecorder {
+		return do(srv, method, path, body, "Accept", accept)
+	}
+	isV1 := func(t *testing.T, rec *httptest.ResponseRecorder) JWTPairResponse {
+		pair := decodePair(t, rec)
+		assert.NotEmpty(t, rec.Header().Get("Deprecation"))
+		assert.Equal(t, "Thu, 01 Apr 2027 00:00:00 GMT", rec.Header().Get("Sunset"))
+		require.NotEmpty(t, pair.Refresh)
+		return pair
+	}
+	isV2 := func(t *testing.T, rec *httptest.ResponseRecorder) TokenResponse {
+		resp := decode[TokenResponse](t, rec, http.StatusOK)
+		assert.Empty(t, rec.Header().Get("Deprecation"))
+		require.NotEmpty(t, resp.RefreshToken)
+		return resp
+	}
+	generate := `{"user_id":"` + testUserID + `"}`
+
+	t.Run("v1 by path", func(t *testing.T) {
+		pair := isV1(t, call(http.MethodPost, "/api/v1/generate", generate, ""))
+		isV1(t, call(http.MethodPut, "/api/v1/refresh", `{"access":"`+pair.Access+`","refresh":"`+pair.Refresh+`"}`, ""))
+	})
+
+	t.Run("v1 by default", func(t *testing.T) {
+		isV1(t, call(http.MethodPost, "/api/generate", generate, "application/json"))
+	})
+
+	t.Run("v2 by path", func(t *testing.T) {
+		pair := isV2(t, call(http.MethodPost, "/api/v2/generate", generate, ""))
+		body := `{"access_token":"` + pair.AccessToken + `","refresh_token":"` + pair.RefreshToken + `"}`
+		isV2(t, call(http.MethodPut, "/api/v2/refresh", body, ""))
+	})
+
+	t.Run("v2 by Accept", func(t *testing.T) {
+		rec := call(http.MethodPost, "/api/generate", generate, "application/json;q=0.5, "+mediaTypeV2)
+		isV2(t, rec)
+		assert.Equal(t, "Accept", rec.Header().Get("Vary"))
+	})
+
+	t.Run("v2 errors", func(t *testing.T) {
+		rec := call(http.MethodPut, "/api/v2/refresh", `{"refresh":"token"}`, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), `"field":"refresh_token"`)
+	})
+
+	t.Run("v2 without body", func(t *testing.T) {
+		rec := call(http.MethodPost, "/api/v2/email/verify", `{"email":"user@example.com"}`, "")
+		assert.Equal(t, http.StatusNotImplemented, rec.Code, "memory driver has no accounts")
+		assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+	})
+}
+
+func TestV1Deprecation(t *testing.T) {
+	deprecated := time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+	srv := newTestServer(t, WithV1Deprecated(deprecated))
+	rec := do(srv, http.MethodPost, "/api/v1/generate", `{"user_id":"`+testUserID+`"}`)
+	assert.Equal(t, "@1798761600", rec.Header().Get("Deprecation"))
+
+	_, err := New(slog.Default(), "", gin.ReleaseMode, newTestApp(),
+		WithV1Deprecated(deprecated), WithV1Sunset(deprecated.Add(-time.Hour)))
+	assert.Error(t, err, "sunset before deprecation")
+}
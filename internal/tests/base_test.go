@@ -2,12 +2,18 @@ package tests
 
 import (
 	"github.com/stretchr/testify/require"
+	"jwt-auth/internal/app"
+	"strings"
 	"testing"
 	"time"
 )
 
 func TestGenerate(t *testing.T) {
-	client := setupClient(time.Second*2, time.Second*4)
+	forEachStorage(t, testGenerate)
+}
+
+func testGenerate(t *testing.T, s storage) {
+	client := setupClient(s, time.Second*2, time.Second*4)
 	usr := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
 
 	p1, err := client.generate(usr)
@@ -30,7 +36,11 @@ func TestGenerate(t *testing.T) {
 }
 
 func TestRefresh(t *testing.T) {
-	client := setupClient(time.Second*2, time.Second*4)
+	forEachStorage(t, testRefresh)
+}
+
+func testRefresh(t *testing.T, s storage) {
+	client := setupClient(s, time.Second*2, time.Second*4)
 	usr := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
 	notFound := "f47ac10b-58cc-4372-a567-0e02b2c3d479"
 
@@ -69,3 +79,126 @@ func TestRefresh(t *testing.T) {
 	_, err = client.refresh(gen2.Access, gen2.Refresh)
 	require.ErrorIs(t, err, ErrForbidden, "refreshing with expired refresh token")
 }
+
+func TestSelectorRefresh(t *testing.T) {
+	forEachStorage(t, testSelectorRefresh)
+}
+
+func testSelectorRefresh(t *testing.T, s storage) {
+	client := setupClient(s, time.Second, time.Minute, app.WithSelectorTokens())
+	usr := "0e9c7a7e-4b1b-4d6e-9f5e-3b8a1c2d4e5f"
+
+	gen, err := client.generate(usr)
+	require.NoError(t, err, "correct generating")
+	require.Contains(t, gen.Refresh, ".", "refresh token has a selector")
+
+	ref, err := client.refresh("", gen.Refresh)
+	require.NoError(t, err, "refreshing without access token")
+	selector, _, _ := strings.Cut(gen.Refresh, ".")
+	require.True(t, strings.HasPrefix(ref.Refresh, selector+"."), "selector is kept")
+
+	_, err = client.refresh("", gen.Refresh)
+	require.ErrorIs(t, err, ErrForbidden, "refreshing with old refresh")
+
+	_, err = client.refresh("", "unknown-selector."+strings.SplitN(ref.Refresh, ".", 2)[1])
+	require.ErrorIs(t, err, ErrNotFound, "refreshing with unknown selector")
+
+	gen2, err := client.generate(usr)
+	require.NoError(t, err)
+	_, err = client.refresh("", ref.Refresh)
+	require.ErrorIs(t, err, ErrNotFound, "selector is replaced by generating new pair")
+	_, err = client.refresh("", gen2.Refresh)
+	require.NoError(t, err)
+}
+
+func TestPasswordReset(t *testing.T) {
+	forEachStorage(t, testPasswordReset)
+}
+
+func testPasswordReset(t *testing.T, s storage) {
+	if s.users == nil {
+		t.Skip("the storage has no user accounts")
+	}
+	client := setupClient(s, time.Minute, time.Minute)
+	email := "reset@example.com"
+
+	require.NoError(t, client.register(email, "first-password"), "registration")
+	require.ErrorIs(t, client.register(email, "first-password"), ErrConflict, "repeat registration")
+
+	require.NoError(t, client.verifyEmail(email, client.mailbox.last(email)), "email verification")
+	require.ErrorIs(t, client.verifyEmail(email, client.mailbox.last(email)), ErrForbidden, "reusing verification token")
+
+	pair, err := client.login(email, "first-password")
+	require.NoError(t, err, "login")
+	_, err = client.login(email, "wrong-password")
+	require.ErrorIs(t, err, ErrForbidden, "login with wrong password")
+
+	require.NoError(t, client.forgotPassword("unknown@example.com"), "unknown email is not reported")
+	require.NoError(t, client.forgotPassword(email), "forgot password")
+	token := client.mailbox.last(email)
+	require.NoError(t, client.resetPassword(email, token, "second-password"), "password reset")
+	require.ErrorIs(t, client.resetPassword(email, token, "third-password"), ErrForbidden, "reusing reset token")
+
+	_, err = client.refresh(pair.Access, pair.Refresh)
+	require.ErrorIs(t, err, ErrNotFound, "refreshing after password reset")
+
+	_, err = client.login(email, "first-password")
+	require.ErrorIs(t, err, ErrForbidden, "login with old password")
+	_, err = client.login(email, "second-password")
+	require.NoError(t, err, "login with new password")
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	forEachStorage(t, testConcurrentRefresh)
+}
+
+func testConcurrentRefresh(t *testing.T, s storage) {
+	client := setupClient(s, time.Minute, time.Minute)
+	usr := "3f2504e0-4f89-11d3-9a0c-0305e82c3301"
+
+	gen, err := client.generate(usr)
+	require.NoError(t, err)
+
+	const concurrency = 10
+	errs := make(chan error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			_, err := client.refresh(gen.Access, gen.Refresh)
+			errs <- err
+		}()
+	}
+	succeeded := 0
+	for i := 0; i < concurrency; i++ {
+		if err := <-errs; err == nil {
+			succeeded++
+		} else {
+			require.ErrorIs(t, err, ErrForbidden, "losing refresh")
+		}
+	}
+	require.Equal(t, 1, succeeded, "exactly one refresh wins")
+}
+
+func TestGraceRefresh(t *testing.T) {
+	forEachStorage(t, testGraceRefresh)
+}
+
+func testGraceRefresh(t *testing.T, s storage) {
+	client := setupClient(s, time.Minute, time.Minute, app.WithRefreshGrace(time.Minute))
+	usr := "9b2e4c1a-7d3f-4e8b-a5c6-1f0d2e3b4a59"
+
+	gen, err := client.generate(usr)
+	require.NoError(t, err)
+	ref, err := client.refresh(gen.Access, gen.Refresh)
+	require.NoError(t, err, "correct refreshing")
+
+	again, err := client.refresh(gen.Access, gen.Refresh)
+	require.NoError(t, err, "refreshing with the replaced token during the grace")
+	require.Equal(t, ref, again, "the same pair is returned")
+
+	next, err := client.refresh(ref.Access, ref.Refresh)
+	require.NoError(t, err, "the new pair is still valid")
+	_, err = client.refresh(gen.Access, gen.Refresh)
+	require.ErrorIs(t, err, ErrForbidden, "the grace is over after the next refresh")
+	_, err = client.refresh(next.Access, next.Refresh)
+	require.NoError(t, err)
+}
@@ -0,0 +1,37 @@
+package tests
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	repo "jwt-auth/internal/adapters/mongo"
+	"testing"
+)
+
+func TestMongoMigrations(t *testing.T) {
+	ctx := context.Background()
+	database := db.Database("test")
+
+	require.NoError(t, repo.Migrate(ctx, database), "repeat migration")
+	applied, err := database.Collection("schema_migrations").CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.EqualValues(t, repo.Version(), applied, "every version is recorded once")
+
+	cursor, err := database.Collection("tokens").Indexes().List(ctx)
+	require.NoError(t, err)
+	var indexes []bson.M
+	require.NoError(t, cursor.All(ctx, &indexes))
+	ttl := false
+	for _, index := range indexes {
+		if _, ok := index["expireAfterSeconds"]; ok && index["name"] == "expires_1" {
+			ttl = true
+		}
+	}
+	assert.True(t, ttl, "TTL index on expires")
+
+	_, err = database.Collection("tokens").InsertOne(ctx, bson.M{"_id": "invalid", "hash": 1})
+	var writeErr mongo.WriteException
+	require.ErrorAs(t, err, &writeErr, "schema validation")
+}
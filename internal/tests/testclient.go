@@ -2,18 +2,28 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/goccy/go-json"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"go.etcd.io/bbolt"
 	"go.mongodb.org/mongo-driver/mongo"
 	"io"
 	"jwt-auth/internal/adapters/bcrypt"
+	"jwt-auth/internal/adapters/bolt"
+	"jwt-auth/internal/adapters/memory"
 	repo "jwt-auth/internal/adapters/mongo"
+	"jwt-auth/internal/adapters/postgres"
+	redisrepo "jwt-auth/internal/adapters/redis"
 	"jwt-auth/internal/app"
 	"jwt-auth/internal/httpserver"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"testing"
 	"time"
 )
 
@@ -21,32 +31,108 @@ var (
 	ErrBadRequest = fmt.Errorf("bad request")
 	ErrForbidden  = fmt.Errorf("forbidden")
 	ErrNotFound   = fmt.Errorf("not found")
+	ErrConflict   = fmt.Errorf("conflict")
 )
 
 const accessSecret = "access-test-secret"
 
-var db *mongo.Client
+var (
+	db     *mongo.Client
+	pg     *pgxpool.Pool
+	boltDB *bbolt.DB
+	rdb    *redis.Client
+)
+
+// storage is a pair of adapters the suite is run against. Storages without user
+// accounts have nil users
+type storage struct {
+	repo  app.Repo
+	users app.Users
+}
+
+func storages() map[string]func() storage {
+	return map[string]func() storage{
+		"mongo": func() storage {
+			return storage{repo: repo.New(db.Database("test")), users: repo.NewUsers(db.Database("test"))}
+		},
+		"postgres": func() storage {
+			return storage{repo: postgres.New(pg), users: postgres.NewUsers(pg)}
+		},
+		"bolt": func() storage {
+			return storage{repo: bolt.New(boltDB), users: bolt.NewUsers(boltDB)}
+		},
+		"memory": func() storage {
+			return storage{repo: memory.NewRepo()}
+		},
+		"redis": func() storage {
+			return storage{repo: redisrepo.New(rdb)}
+		},
+	}
+}
+
+// forEachStorage runs the test against every storage adapter
+func forEachStorage(t *testing.T, test func(t *testing.T, s storage)) {
+	for name, setup := range storages() {
+		t.Run(name, func(t *testing.T) {
+			test(t, setup())
+		})
+	}
+}
+
+// mailbox keeps the last token sent to every email instead of sending it
+type mailbox struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
 
-func setupClient(accessExp time.Duration, refreshExp time.Duration) *testClient {
+func (m *mailbox) store(email string, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[email] = token
+	return nil
+}
+
+func (m *mailbox) SendPasswordReset(_ context.Context, email string, token string) error {
+	return m.store(email, token)
+}
+
+func (m *mailbox) SendVerification(_ context.Context, email string, token string) error {
+	return m.store(email, token)
+}
+
+func (m *mailbox) last(email string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tokens[email]
+}
+
+func setupClient(s storage, accessExp time.Duration, refreshExp time.Duration, opts ...app.Option) *testClient {
+	box := &mailbox{tokens: make(map[string]string)}
 	a := app.New(
-		repo.New(db.Database("test")),
+		s.repo,
 		bcrypt.New(10),
 		accessSecret,
 		accessExp,
 		refreshExp,
+		append([]app.Option{app.WithUsers(s.users, box)}, opts...)...,
 	)
-	srv := httpserver.New(slog.Default(), ":18080", gin.ReleaseMode, a)
+	srv, err := httpserver.New(slog.Default(), ":18080", gin.ReleaseMode, a)
+	if err != nil {
+		panic(err)
+	}
 	testSrv := httptest.NewServer(srv.Handler)
 
 	return &testClient{
 		client:  testSrv.Client(),
 		baseURL: testSrv.URL,
+		mailbox: box,
 	}
 }
 
 type testClient struct {
 	client  *http.Client
 	baseURL string
+	mailbox *mailbox
 }
 
 func (tc *testClient) request(body map[string]any, method string, endpoint string, out any) error {
@@ -65,7 +151,7 @@ func (tc *testClient) request(body map[string]any, method string, endpoint strin
 		return fmt.Errorf("unexpected error: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
 		if resp.StatusCode == http.StatusNotFound {
 			return ErrNotFound
 		}
@@ -75,6 +161,9 @@ func (tc *testClient) request(body map[string]any, method string, endpoint strin
 		if resp.StatusCode == http.StatusForbidden {
 			return ErrForbidden
 		}
+		if resp.StatusCode == http.StatusConflict {
+			return ErrConflict
+		}
 		return fmt.Errorf("unexpected status code: %s", resp.Status)
 	}
 
@@ -115,3 +204,45 @@ func (tc *testClient) refresh(access string, refresh string) (jwtPair, error) {
 	err := tc.request(body, http.MethodPut, "refresh", &response)
 	return response.Data, err
 }
+
+func (tc *testClient) register(email string, password string) error {
+	body := map[string]any{
+		"email":    email,
+		"password": password,
+	}
+	return tc.request(body, http.MethodPost, "register", &map[string]any{})
+}
+
+func (tc *testClient) login(email string, password string) (jwtPair, error) {
+	body := map[string]any{
+		"email":    email,
+		"password": password,
+	}
+	var response jwtPairResponse
+	err := tc.request(body, http.MethodPost, "login", &response)
+	return response.Data, err
+}
+
+func (tc *testClient) verifyEmail(email string, token string) error {
+	body := map[string]any{
+		"email": email,
+		"token": token,
+	}
+	return tc.request(body, http.MethodPut, "email/verify", &map[string]any{})
+}
+
+func (tc *testClient) forgotPassword(email string) error {
+	body := map[string]any{
+		"email": email,
+	}
+	return tc.request(body, http.MethodPost, "password/forgot", &map[string]any{})
+}
+
+func (tc *testClient) resetPassword(email string, token string, password string) error {
+	body := map[string]any{
+		"email":    email,
+		"token":    token,
+		"password": password,
+	}
+	return tc.request(body, http.MethodPut, "password/reset", &map[string]any{})
+}